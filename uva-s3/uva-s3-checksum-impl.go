@@ -0,0 +1,179 @@
+package uva_s3
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// objects larger than this cannot be uploaded in a single request
+const maxSinglePutSize = int64(5 * 1024 * 1024 * 1024)
+
+// is the checksum algorithm one we support
+func validChecksumAlgorithm(algorithm UvaS3ChecksumAlgorithm) bool {
+	return newChecksumHash(algorithm) != nil
+}
+
+// a hash for the supplied checksum algorithm, nil if it is not supported
+func newChecksumHash(algorithm UvaS3ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case CHECKSUM_CRC32:
+		return crc32.NewIEEE()
+	case CHECKSUM_CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case CHECKSUM_SHA1:
+		return sha1.New()
+	case CHECKSUM_SHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// the checksum of the supplied content in the form S3 uses (base64 encoded)
+func checksumOf(algorithm UvaS3ChecksumAlgorithm, reader io.Reader) (string, error) {
+	h := newChecksumHash(algorithm)
+	_, err := io.Copy(h, reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// the checksum of the part checksums of the supplied content uploaded in parts of the supplied size, in the form
+// S3 uses for a multipart upload (base64 encoded followed by the part count)
+func compositeChecksumOf(algorithm UvaS3ChecksumAlgorithm, reader io.Reader, partSize int64) (string, error) {
+
+	sums := make([]byte, 0)
+	parts := 0
+	for {
+		h := newChecksumHash(algorithm)
+		n, err := io.Copy(h, io.LimitReader(reader, partSize))
+		if err != nil {
+			return "", err
+		}
+		if n == 0 && parts != 0 {
+			break
+		}
+		sums = h.Sum(sums)
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+
+	h := newChecksumHash(algorithm)
+	h.Write(sums)
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), parts), nil
+}
+
+// is the checksum of the whole object (rather than a checksum of the part checksums of a multipart upload)
+func isFullObjectChecksum(checksum string) bool {
+	return len(checksum) != 0 && strings.Contains(checksum, "-") == false
+}
+
+// the checksums from the object attributes
+func headChecksums(result *s3.HeadObjectOutput) map[UvaS3ChecksumAlgorithm]string {
+	checksums := make(map[UvaS3ChecksumAlgorithm]string)
+	for algorithm, value := range map[UvaS3ChecksumAlgorithm]*string{
+		CHECKSUM_CRC32:  result.ChecksumCRC32,
+		CHECKSUM_CRC32C: result.ChecksumCRC32C,
+		CHECKSUM_SHA1:   result.ChecksumSHA1,
+		CHECKSUM_SHA256: result.ChecksumSHA256,
+	} {
+		if value != nil {
+			checksums[algorithm] = *value
+		}
+	}
+	return checksums
+}
+
+// set the checksum of a single part upload
+func setUploadChecksum(input *s3manager.UploadInput, algorithm UvaS3ChecksumAlgorithm, checksum string) {
+	input.ChecksumAlgorithm = aws.String(string(algorithm))
+	switch algorithm {
+	case CHECKSUM_CRC32:
+		input.ChecksumCRC32 = aws.String(checksum)
+	case CHECKSUM_CRC32C:
+		input.ChecksumCRC32C = aws.String(checksum)
+	case CHECKSUM_SHA1:
+		input.ChecksumSHA1 = aws.String(checksum)
+	case CHECKSUM_SHA256:
+		input.ChecksumSHA256 = aws.String(checksum)
+	}
+}
+
+// set the checksum of one part of a multipart upload
+func setPartChecksum(input *s3.UploadPartInput, algorithm UvaS3ChecksumAlgorithm, checksum string) {
+	input.ChecksumAlgorithm = aws.String(string(algorithm))
+	switch algorithm {
+	case CHECKSUM_CRC32:
+		input.ChecksumCRC32 = aws.String(checksum)
+	case CHECKSUM_CRC32C:
+		input.ChecksumCRC32C = aws.String(checksum)
+	case CHECKSUM_SHA1:
+		input.ChecksumSHA1 = aws.String(checksum)
+	case CHECKSUM_SHA256:
+		input.ChecksumSHA256 = aws.String(checksum)
+	}
+}
+
+// set the checksum of a completed part of a multipart upload
+func setCompletedPartChecksum(part *s3.CompletedPart, algorithm UvaS3ChecksumAlgorithm, checksum string) {
+	switch algorithm {
+	case CHECKSUM_CRC32:
+		part.ChecksumCRC32 = aws.String(checksum)
+	case CHECKSUM_CRC32C:
+		part.ChecksumCRC32C = aws.String(checksum)
+	case CHECKSUM_SHA1:
+		part.ChecksumSHA1 = aws.String(checksum)
+	case CHECKSUM_SHA256:
+		part.ChecksumSHA256 = aws.String(checksum)
+	}
+}
+
+// force the uploader to use a single request for an upload of the supplied size (so the checksum we computed
+// applies to the whole object)
+func singlePartUpload(size int64) func(*s3manager.Uploader) {
+	return func(u *s3manager.Uploader) {
+		if u.PartSize < size {
+			u.PartSize = size
+		}
+	}
+}
+
+// validate the downloaded content against the full object checksums of the object, objects without such a
+// checksum are always valid. The checksums of multipart uploads are validated with the entity tag once we
+// know the part layout
+func validateChecksums(obj UvaS3Object, content io.ReadSeeker) error {
+
+	for algorithm, expected := range obj.Checksums() {
+		if isFullObjectChecksum(expected) == false || validChecksumAlgorithm(algorithm) == false {
+			continue
+		}
+
+		_, err := content.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		actual, err := checksumOf(algorithm, content)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return ErrChecksumMismatch
+		}
+	}
+	return nil
+}
+
+//
+// end of file
+//
@@ -0,0 +1,58 @@
+package uva_s3
+
+import (
+	"context"
+	"sync"
+)
+
+// call fn for each index in [0, n) using the supplied number of workers. Dispatching stops at the first error
+// (which also cancels the context passed to fn) or when the context is done. Returns the first error or the
+// context error
+func forEachConcurrently(ctx context.Context, n int, workers int, fn func(context.Context, int) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var firstErr error
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ix := range work {
+				err := fn(ctx, ix)
+				if err != nil {
+					m.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					m.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for ix := 0; ix < n; ix++ {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case work <- ix:
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+//
+// end of file
+//
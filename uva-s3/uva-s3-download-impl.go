@@ -0,0 +1,286 @@
+package uva_s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// the part size and concurrency for resumable downloads
+const downloadPartSize = int64(64 * 1024 * 1024)
+const downloadConcurrency = 4
+
+// the suffix of the state file kept beside the target of a resumable download
+const downloadStateSuffix = ".uvas3-download"
+
+// the first entry of a download state file identifies the object being downloaded. The remaining entries
+// (one per line) record the parts that have been written to the target file
+type downloadStateHeader struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Version  string `json:"version,omitempty"`
+	ETag     string `json:"etag"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"part_size"`
+}
+
+type downloadStatePart struct {
+	Part int64 `json:"part"`
+}
+
+// the state of a resumable download
+type downloadState struct {
+	header downloadStateHeader
+	done   map[int64]bool // the parts already written to the target file
+	file   *jsonLinesFile // the state file
+	lock   sync.Mutex     // protects done and file
+}
+
+// get an object to a local file, continuing from where an earlier attempt left off when the object is unchanged
+func (impl *uvaS3Impl) getToFileResumable(ctx context.Context, obj UvaS3Object, location string) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false || len(location) == 0 {
+		return ErrBadParameter
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if s.IsGlacier() == true && s.IsRestored() == false {
+		return ErrObjectInGlacier
+	}
+
+	err = impl.resumeDownload(ctx, obj, s, location)
+
+	// the object changed underneath us so start again from scratch
+	if err == ErrObjectChanged {
+		impl.logWarn(fmt.Sprintf("s3://%s/%s changed during download, restarting", obj.BucketName(), obj.KeyName()))
+		_ = os.Remove(location + downloadStateSuffix)
+		s, err = impl.StatObjectWithContext(ctx, obj)
+		if err != nil {
+			return err
+		}
+		err = impl.resumeDownload(ctx, obj, s, location)
+	}
+	return err
+}
+
+// download the parts of the object not recorded in the state file
+func (impl *uvaS3Impl) resumeDownload(ctx context.Context, obj UvaS3Object, s UvaS3Object, location string) error {
+
+	source := fmt.Sprintf("s3://%s/%s", obj.BucketName(), obj.KeyName())
+	header := downloadStateHeader{
+		Bucket:   obj.BucketName(),
+		Key:      obj.KeyName(),
+		Version:  obj.VersionId(),
+		ETag:     s.ETag(),
+		Size:     s.Size(),
+		PartSize: downloadPartSize,
+	}
+
+	stateFile := location + downloadStateSuffix
+	state, err := loadDownloadState(stateFile)
+	if err != nil {
+		impl.logWarn(fmt.Sprintf("ignoring download state %s (%s)", stateFile, err.Error()))
+	}
+
+	// we can only continue an earlier download of the same object into the same file
+	flags := os.O_RDWR | os.O_CREATE
+	if state == nil || state.header != header || fileSizeIs(location, header.Size) == false {
+		if state != nil {
+			impl.logInfo(fmt.Sprintf("%s has changed since the earlier download, starting again", source))
+			state.close()
+		}
+		state, err = newDownloadState(stateFile, header)
+		if err != nil {
+			return err
+		}
+		flags |= os.O_TRUNC
+	} else {
+		impl.logInfo(fmt.Sprintf("resuming get %s to %s (%d parts already complete)", source, location, len(state.done)))
+	}
+	defer state.close()
+
+	file, err := os.OpenFile(location, flags, 0755)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = file.Truncate(header.Size)
+	if err != nil {
+		return err
+	}
+
+	parts := (header.Size + header.PartSize - 1) / header.PartSize
+	pending := make([]int64, 0)
+	for p := int64(0); p < parts; p++ {
+		if state.done[p] == false {
+			pending = append(pending, p)
+		}
+	}
+
+	impl.logInfo(fmt.Sprintf("get %s to %s (%d of %d parts remaining)", source, location, len(pending), parts))
+
+	start := time.Now()
+	err = impl.downloadParts(ctx, obj, file, state, pending)
+	if err != nil {
+		// we keep the partial file and the state so we can continue later
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	// validate the content against the object checksum and entity tag, starting again next time if it does
+	// not match
+	err = impl.validateContent(ctx, obj, s, file)
+	if err != nil {
+		state.close()
+		_ = os.Remove(stateFile)
+		file.Close()
+		_ = os.Remove(location)
+		return err
+	}
+
+	// the download is complete so we no longer need the state
+	state.close()
+	_ = os.Remove(stateFile)
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("get of %s complete in %0.2f seconds (%d bytes)", source, duration.Seconds(), header.Size))
+	return nil
+}
+
+// download the supplied parts concurrently, recording each one in the state once it is written
+func (impl *uvaS3Impl) downloadParts(ctx context.Context, obj UvaS3Object, file *os.File, state *downloadState, pending []int64) error {
+	return forEachConcurrently(ctx, len(pending), downloadConcurrency, func(ctx context.Context, ix int) error {
+		return impl.downloadPart(ctx, obj, file, state, pending[ix])
+	})
+}
+
+// download one part into place in the target file
+func (impl *uvaS3Impl) downloadPart(ctx context.Context, obj UvaS3Object, file *os.File, state *downloadState, part int64) error {
+
+	offset := part * state.header.PartSize
+	length := state.header.PartSize
+	if offset+length > state.header.Size {
+		length = state.header.Size - offset
+	}
+
+	byteRange, _ := rangeHeader(offset, length)
+	reader, err := impl.getReader(ctx, obj, byteRange, state.header.ETag)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(&offsetWriter{w: file, offset: offset}, reader)
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("download failure. expected %d bytes, received %d bytes", length, n)
+	}
+
+	// the part must be on disk before we record it, otherwise a crash could leave the state claiming data
+	// that was never written
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	return state.complete(part)
+}
+
+// create a new state file for a download
+func newDownloadState(name string, header downloadStateHeader) (*downloadState, error) {
+
+	file, err := createJSONLines(name, header)
+	if err != nil {
+		return nil, err
+	}
+	return &downloadState{header: header, done: make(map[int64]bool), file: file}, nil
+}
+
+// load the state of an earlier download, returns nil if there is none
+func loadDownloadState(name string) (*downloadState, error) {
+
+	var state downloadState
+	state.done = make(map[int64]bool)
+
+	_, err := readJSONLines(name, &state.header, func(b []byte) error {
+		var p downloadStatePart
+		err := json.Unmarshal(b, &p)
+		if err == nil {
+			state.done[p.Part] = true
+		}
+		return err
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// reopen for append so we can record further progress
+	state.file, err = openJSONLines(name)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// record a completed part
+func (state *downloadState) complete(part int64) error {
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.done[part] = true
+	return state.file.append(downloadStatePart{Part: part})
+}
+
+func (state *downloadState) close() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.file != nil {
+		state.file.close()
+		state.file = nil
+	}
+}
+
+// is the named file the expected size
+func fileSizeIs(name string, size int64) bool {
+	s, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return s.Size() == size
+}
+
+// adapts an io.WriterAt to an io.Writer starting at the supplied offset
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
+
+//
+// end of file
+//
@@ -2,21 +2,55 @@ package uva_s3
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"hash"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
 
+// the S3 multi-delete API accepts at most this many keys per request
+const deleteBatchSize = 1000
+
+// the number of multi-delete requests we issue concurrently
+const deleteConcurrency = 4
+
+// objects larger than this must be copied using a multipart copy
+const maxCopyObjectSize = int64(5 * 1024 * 1024 * 1024)
+
+// the part size for multipart copies (increased if necessary to stay within the part count limit)
+const copyPartSize = int64(512 * 1024 * 1024)
+
+// the number of parts of a multipart copy we copy concurrently
+const copyConcurrency = 4
+
+// the part size and concurrency for uploads from a stream, together they bound the memory used for
+// buffering (and the part size limits the object size to 10000 parts)
+const streamPartSize = int64(32 * 1024 * 1024)
+const streamConcurrency = 4
+
+// the default restore poll policy
+const defaultPollInitialInterval = 1 * time.Minute
+const defaultPollMaxInterval = 15 * time.Minute
+const defaultPollMultiplier = 2.0
+
 // this is our s3 interface implementation
 type uvaS3Impl struct {
 	config     UvaS3Config
+	sess       *session.Session
 	svc        *s3.S3
 	downloader *s3manager.Downloader
 	uploader   *s3manager.Uploader
@@ -26,11 +60,29 @@ type uvaS3Impl struct {
 type uvaS3ObjectImpl struct {
 	bucket       string
 	key          string
+	versionId    string    // the version id, empty when the latest version is implied
+	isLatest     bool      // is this the latest version
+	isDelete     bool      // is this a delete marker
 	isGlacier    bool      // is the object stored in glacier
 	isRestoring  bool      // is the object currently being restored
 	isRestored   bool      // has the object been restored
 	size         int64     // object size
 	lastModified time.Time // last modified time
+	etag         string    // the entity tag
+
+	storageClass      UvaS3StorageClass // the storage class
+	contentType       string            // the content type
+	metadata          map[string]string // user metadata
+	sse               string            // server side encryption algorithm
+	sseKmsKeyId       string            // KMS key id
+	replicationStatus string            // replication status
+	expiryDate        time.Time         // lifecycle expiry date
+	expiryRule        string            // lifecycle expiry rule id
+	restoreExpiry     time.Time         // when the restored copy expires
+	archiveStatus     string            // the intelligent tiering archive tier
+
+	checksums map[UvaS3ChecksumAlgorithm]string // the additional checksums
+	headed    bool                              // were the attributes read from the object head
 }
 
 // factory for our S3 interface
@@ -43,6 +95,7 @@ func newUvaS3(config UvaS3Config) (UvaS3, error) {
 
 	var impl uvaS3Impl
 	impl.config = config
+	impl.sess = sess
 	impl.uploader = s3manager.NewUploader(sess)
 	impl.downloader = s3manager.NewDownloader(sess)
 	impl.svc = s3.New(sess)
@@ -56,7 +109,31 @@ func newUvaS3Object(bucketName string, keyName string) UvaS3Object {
 	return uvaS3ObjectImpl{bucket: bucketName, key: keyName, size: -1}
 }
 
+// factory for our versioned S3 object interface
+func newUvaS3ObjectVersion(bucketName string, keyName string, versionId string) UvaS3Object {
+	// we use -1 as a sentinel value
+	return uvaS3ObjectImpl{bucket: bucketName, key: keyName, versionId: versionId, size: -1}
+}
+
 func (impl *uvaS3Impl) GetToFile(obj UvaS3Object, location string) error {
+	return impl.GetToFileWithContext(context.Background(), obj, location)
+}
+
+func (impl *uvaS3Impl) GetToFileWithContext(ctx context.Context, obj UvaS3Object, location string) error {
+
+	err := impl.getToFile(ctx, obj, location)
+
+	// optionally restore archived objects and try again
+	if err == ErrObjectInGlacier && impl.config.AutoRestore == true {
+		err = impl.autoRestore(ctx, obj)
+		if err == nil {
+			err = impl.getToFile(ctx, obj, location)
+		}
+	}
+	return err
+}
+
+func (impl *uvaS3Impl) getToFile(ctx context.Context, obj UvaS3Object, location string) error {
 
 	// validate inbound parameters
 	if impl.validateS3Obj(obj) == false || len(location) == 0 {
@@ -67,20 +144,36 @@ func (impl *uvaS3Impl) GetToFile(obj UvaS3Object, location string) error {
 
 	impl.logInfo(fmt.Sprintf("get %s to %s", source, location))
 
-	file, err := os.OpenFile(location, os.O_RDWR|os.O_CREATE, 0755)
+	// we need the object attributes to validate what we download, listings do not include them all
+	attrs := obj
+	if hasAttributes(attrs) == false {
+		s, err := impl.StatObjectWithContext(ctx, obj)
+		if err != nil {
+			return err
+		}
+		attrs = s
+	}
+
+	// archived objects cannot be read so dont touch any existing file
+	if attrs.IsGlacier() == true && attrs.IsRestored() == false {
+		return ErrObjectInGlacier
+	}
+
+	// truncate any existing file, we validate the content of the whole file
+	file, err := os.OpenFile(location, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
 	start := time.Now()
-	fileSize, err := impl.downloader.Download(file,
-		&s3.GetObjectInput{
-			Bucket: aws.String(obj.BucketName()),
-			Key:    aws.String(obj.KeyName()),
-		})
+	fileSize, err := impl.downloader.DownloadWithContext(ctx, file, getObjectInput(obj, attrs))
 
 	if err != nil {
+		// remove the partial output left by a failed or cancelled download
+		file.Close()
+		_ = os.Remove(location)
+
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchBucket:
@@ -89,9 +182,13 @@ func (impl *uvaS3Impl) GetToFile(obj UvaS3Object, location string) error {
 			case s3.ErrCodeNoSuchKey:
 				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
 				return ErrNotFound
+			case "NoSuchVersion":
+				return ErrNotFound
 			case s3.ErrCodeInvalidObjectState:
 				//	log.Printf("ERROR: inappropriate storage class for get (%s)", aerr.Error())
 				return ErrObjectInGlacier
+			case "PreconditionFailed":
+				return ErrObjectChanged
 			default:
 				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
 			}
@@ -106,11 +203,19 @@ func (impl *uvaS3Impl) GetToFile(obj UvaS3Object, location string) error {
 
 	//	// I think there are times when the download runs out of space but it is not reported as an error so
 	//	// we validate the expected file size against the actually downloaded size
-	if obj.Size() != -1 && obj.Size() != fileSize {
+	if attrs.Size() != fileSize {
 
 		// remove the file
 		_ = os.Remove(location)
-		return fmt.Errorf("download failure. expected %d bytes, received %d bytes", obj.Size(), fileSize)
+		return fmt.Errorf("download failure. expected %d bytes, received %d bytes", attrs.Size(), fileSize)
+	}
+
+	// and the content against the object checksum and entity tag
+	err = impl.validateContent(ctx, obj, attrs, file)
+	if err != nil {
+		file.Close()
+		_ = os.Remove(location)
+		return err
 	}
 
 	duration := time.Since(start)
@@ -118,22 +223,59 @@ func (impl *uvaS3Impl) GetToFile(obj UvaS3Object, location string) error {
 	return nil
 }
 
+func (impl *uvaS3Impl) GetToFileResumable(obj UvaS3Object, location string) error {
+	return impl.GetToFileResumableWithContext(context.Background(), obj, location)
+}
+
+func (impl *uvaS3Impl) GetToFileResumableWithContext(ctx context.Context, obj UvaS3Object, location string) error {
+
+	err := impl.getToFileResumable(ctx, obj, location)
+
+	// optionally restore archived objects and try again
+	if err == ErrObjectInGlacier && impl.config.AutoRestore == true {
+		err = impl.autoRestore(ctx, obj)
+		if err == nil {
+			err = impl.getToFileResumable(ctx, obj, location)
+		}
+	}
+	return err
+}
+
 func (impl *uvaS3Impl) GetToBuffer(obj UvaS3Object) ([]byte, error) {
+	return impl.GetToBufferWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) GetToBufferWithContext(ctx context.Context, obj UvaS3Object) ([]byte, error) {
+
+	buf, err := impl.getToBuffer(ctx, obj)
+
+	// optionally restore archived objects and try again
+	if err == ErrObjectInGlacier && impl.config.AutoRestore == true {
+		err = impl.autoRestore(ctx, obj)
+		if err == nil {
+			buf, err = impl.getToBuffer(ctx, obj)
+		}
+	}
+	return buf, err
+}
+
+func (impl *uvaS3Impl) getToBuffer(ctx context.Context, obj UvaS3Object) ([]byte, error) {
 
 	// validate inbound parameters
 	if impl.validateS3Obj(obj) == false {
 		return nil, ErrBadParameter
 	}
 
-	expectedSize := obj.Size()
-	// if we do not yet know the filesize
-	if expectedSize == -1 {
-		s, err := impl.StatObject(obj)
+	// if we do not yet know the filesize (and the other attributes we validate against)
+	attrs := obj
+	if hasAttributes(attrs) == false {
+		s, err := impl.StatObjectWithContext(ctx, obj)
 		if err != nil {
 			return nil, err
 		}
-		expectedSize = s.Size()
+		attrs = s
 	}
+	expectedSize := attrs.Size()
 
 	impl.logInfo(fmt.Sprintf("get from s3://%s/%s (%d bytes)", obj.BucketName(), obj.KeyName(), expectedSize))
 
@@ -141,11 +283,7 @@ func (impl *uvaS3Impl) GetToBuffer(obj UvaS3Object) ([]byte, error) {
 
 	backingBuff := make([]byte, 0, expectedSize)
 	writeAtBuff := aws.NewWriteAtBuffer(backingBuff)
-	downloadSize, err := impl.downloader.Download(writeAtBuff,
-		&s3.GetObjectInput{
-			Bucket: aws.String(obj.BucketName()),
-			Key:    aws.String(obj.KeyName()),
-		})
+	downloadSize, err := impl.downloader.DownloadWithContext(ctx, writeAtBuff, getObjectInput(obj, attrs))
 
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
@@ -156,9 +294,13 @@ func (impl *uvaS3Impl) GetToBuffer(obj UvaS3Object) ([]byte, error) {
 			case s3.ErrCodeNoSuchKey:
 				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
 				return nil, ErrNotFound
+			case "NoSuchVersion":
+				return nil, ErrNotFound
 			case s3.ErrCodeInvalidObjectState:
 				//	log.Printf("ERROR: inappropriate storage class for get (%s)", aerr.Error())
 				return nil, ErrObjectInGlacier
+			case "PreconditionFailed":
+				return nil, ErrObjectChanged
 			default:
 				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
 			}
@@ -176,6 +318,12 @@ func (impl *uvaS3Impl) GetToBuffer(obj UvaS3Object) ([]byte, error) {
 		impl.logWarn(fmt.Sprintf("get s3://%s/%s... expected %d bytes, received %d bytes", obj.BucketName(), obj.KeyName(), expectedSize, downloadSize))
 	}
 
+	// validate the content against the object checksum and entity tag
+	err = impl.validateContent(ctx, obj, attrs, bytes.NewReader(writeAtBuff.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
 	duration := time.Since(start)
 	impl.logInfo(fmt.Sprintf("get of s3://%s/%s complete in %0.2f seconds", obj.BucketName(), obj.KeyName(), duration.Seconds()))
 
@@ -183,9 +331,21 @@ func (impl *uvaS3Impl) GetToBuffer(obj UvaS3Object) ([]byte, error) {
 }
 
 func (impl *uvaS3Impl) PutFromFile(obj UvaS3Object, location string) error {
+	return impl.PutFromFileWithOptions(obj, location, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromFileWithOptions(obj UvaS3Object, location string, options UvaS3PutOptions) error {
+	return impl.PutFromFileWithOptionsContext(context.Background(), obj, location, options)
+}
+
+func (impl *uvaS3Impl) PutFromFileWithContext(ctx context.Context, obj UvaS3Object, location string) error {
+	return impl.PutFromFileWithOptionsContext(ctx, obj, location, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromFileWithOptionsContext(ctx context.Context, obj UvaS3Object, location string, options UvaS3PutOptions) error {
 
 	// validate inbound parameters
-	if impl.validateS3Obj(obj) == false || len(location) == 0 {
+	if impl.validateS3Obj(obj) == false || len(location) == 0 || validPutOptions(options) == false {
 		return ErrBadParameter
 	}
 
@@ -208,19 +368,60 @@ func (impl *uvaS3Impl) PutFromFile(obj UvaS3Object, location string) error {
 	}
 	fileSize := s.Size()
 
+	// files too large for a single request need a checksum for each part so we use our own multipart upload
+	if len(options.Checksum) != 0 && fileSize > maxSinglePutSize {
+		return impl.putFromFileMultipart(ctx, obj, location, options, false)
+	}
+
 	// Upload the file to S3.
 	start := time.Now()
-	_, err = impl.uploader.Upload(&s3manager.UploadInput{
+	upParams := &s3manager.UploadInput{
 		Bucket: aws.String(obj.BucketName()),
 		Key:    aws.String(obj.KeyName()),
 		Body:   file,
-	})
+	}
+	applyPutOptions(upParams, options)
+
+	// the SDK does not compute additional checksums so we do it ourselves
+	upOptions := make([]func(*s3manager.Uploader), 0)
+	if len(options.Checksum) != 0 {
+		checksum, err := checksumOf(options.Checksum, file)
+		if err != nil {
+			return err
+		}
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		setUploadChecksum(upParams, options.Checksum, checksum)
+		upOptions = append(upOptions, singlePartUpload(fileSize))
+	}
+
+	// compute the entity tag we expect the object to have and the Content-MD5 for a single part upload
+	partSize := uploaderPartSize(*impl.uploader, fileSize, upOptions...)
+	hasher := newCountingReader(file, partSize)
+	_, err = io.Copy(io.Discard, hasher)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if fileSize <= partSize {
+		upParams.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(hasher.digest()))
+	}
+
+	result, err := impl.uploader.UploadWithContext(ctx, upParams, upOptions...)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchBucket:
 				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
 				return ErrNotFound
+			case "BadDigest":
+				// the content did not match the Content-MD5 we sent
+				return ErrUploadVerifyFailed
 			//case s3.ErrCodeNoSuchKey:
 			//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
 			//	return ErrNotFound
@@ -238,21 +439,60 @@ func (impl *uvaS3Impl) PutFromFile(obj UvaS3Object, location string) error {
 		}
 	}
 
+	err = impl.verifyUploadETag(ctx, obj, result, hasher.etag(len(result.UploadID) != 0))
+	if err != nil {
+		return err
+	}
+
 	duration := time.Since(start)
 	impl.logInfo(fmt.Sprintf("put %s complete in %0.2f seconds (%d bytes, %0.2f bytes/sec)", source, duration.Seconds(), fileSize, float64(fileSize)/duration.Seconds()))
 	return nil
 }
 
+func (impl *uvaS3Impl) PutFromFileResumable(obj UvaS3Object, location string) error {
+	return impl.PutFromFileResumableWithOptions(obj, location, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromFileResumableWithOptions(obj UvaS3Object, location string, options UvaS3PutOptions) error {
+	return impl.PutFromFileResumableWithOptionsContext(context.Background(), obj, location, options)
+}
+
+func (impl *uvaS3Impl) PutFromFileResumableWithContext(ctx context.Context, obj UvaS3Object, location string) error {
+	return impl.PutFromFileResumableWithOptionsContext(ctx, obj, location, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromFileResumableWithOptionsContext(ctx context.Context, obj UvaS3Object, location string, options UvaS3PutOptions) error {
+	return impl.putFromFileResumable(ctx, obj, location, options)
+}
+
 func (impl *uvaS3Impl) PutFromBuffer(obj UvaS3Object, buffer []byte) error {
+	return impl.PutFromBufferWithOptions(obj, buffer, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromBufferWithOptions(obj UvaS3Object, buffer []byte, options UvaS3PutOptions) error {
+	return impl.PutFromBufferWithOptionsContext(context.Background(), obj, buffer, options)
+}
+
+func (impl *uvaS3Impl) PutFromBufferWithContext(ctx context.Context, obj UvaS3Object, buffer []byte) error {
+	return impl.PutFromBufferWithOptionsContext(ctx, obj, buffer, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromBufferWithOptionsContext(ctx context.Context, obj UvaS3Object, buffer []byte, options UvaS3PutOptions) error {
 
 	// validate inbound parameters
-	if impl.validateS3Obj(obj) == false || buffer == nil {
+	if impl.validateS3Obj(obj) == false || buffer == nil || validPutOptions(options) == false {
 		return ErrBadParameter
 	}
 
 	bucket := obj.BucketName()
 	key := obj.KeyName()
 	size := len(buffer)
+
+	// checksums are only supported for buffers small enough for a single request
+	if len(options.Checksum) != 0 && int64(size) > maxSinglePutSize {
+		return ErrBadParameter
+	}
+
 	impl.logInfo(fmt.Sprintf("put to s3://%s/%s (%d bytes)", bucket, key, size))
 
 	upParams := &s3manager.UploadInput{
@@ -260,17 +500,37 @@ func (impl *uvaS3Impl) PutFromBuffer(obj UvaS3Object, buffer []byte) error {
 		Key:    &key,
 		Body:   bytes.NewReader(buffer),
 	}
+	applyPutOptions(upParams, options)
+
+	// the SDK does not compute additional checksums so we do it ourselves
+	upOptions := make([]func(*s3manager.Uploader), 0)
+	if len(options.Checksum) != 0 {
+		checksum, _ := checksumOf(options.Checksum, bytes.NewReader(buffer))
+		setUploadChecksum(upParams, options.Checksum, checksum)
+		upOptions = append(upOptions, singlePartUpload(int64(size)))
+	}
+
+	// compute the entity tag we expect the object to have and the Content-MD5 for a single part upload
+	partSize := uploaderPartSize(*impl.uploader, int64(size), upOptions...)
+	hasher := newCountingReader(bytes.NewReader(buffer), partSize)
+	_, _ = io.Copy(io.Discard, hasher)
+	if int64(size) <= partSize {
+		upParams.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(hasher.digest()))
+	}
 
 	start := time.Now()
 
 	// Perform an upload.
-	_, err := impl.uploader.Upload(upParams)
+	result, err := impl.uploader.UploadWithContext(ctx, upParams, upOptions...)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchBucket:
 				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
 				return ErrNotFound
+			case "BadDigest":
+				// the content did not match the Content-MD5 we sent
+				return ErrUploadVerifyFailed
 			//case s3.ErrCodeNoSuchKey:
 			//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
 			//	return ErrNotFound
@@ -288,10 +548,11 @@ func (impl *uvaS3Impl) PutFromBuffer(obj UvaS3Object, buffer []byte) error {
 		}
 	}
 
-	// we validate the expected file size against the actually uploaded size
-	//if int64( size ) != uploadSize {
-	//	return nil, fmt.Errorf("upload failure. expected %d bytes, actual %d bytes", contentSize, uploadSize)
-	//}
+	// we validate the uploaded content using the entity tag
+	err = impl.verifyUploadETag(ctx, obj, result, hasher.etag(len(result.UploadID) != 0))
+	if err != nil {
+		return err
+	}
 
 	duration := time.Since(start)
 	impl.logInfo(fmt.Sprintf("put of s3://%s/%s complete in %0.2f seconds", bucket, key, duration.Seconds()))
@@ -299,189 +560,2193 @@ func (impl *uvaS3Impl) PutFromBuffer(obj UvaS3Object, buffer []byte) error {
 	return nil
 }
 
-func (impl *uvaS3Impl) StatObject(obj UvaS3Object) (UvaS3Object, error) {
+func (impl *uvaS3Impl) GetReader(obj UvaS3Object) (io.ReadCloser, error) {
+	return impl.GetReaderWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) GetReaderWithContext(ctx context.Context, obj UvaS3Object) (io.ReadCloser, error) {
+
+	reader, err := impl.getReader(ctx, obj, "", "")
+
+	// optionally restore archived objects and try again
+	if err == ErrObjectInGlacier && impl.config.AutoRestore == true {
+		err = impl.autoRestore(ctx, obj)
+		if err == nil {
+			reader, err = impl.getReader(ctx, obj, "", "")
+		}
+	}
+	return reader, err
+}
+
+// get a reader for the object body, optionally limited to the supplied range and only if the object has the
+// supplied ETag
+func (impl *uvaS3Impl) getReader(ctx context.Context, obj UvaS3Object, byteRange string, etag string) (io.ReadCloser, error) {
 
 	// validate inbound parameters
 	if impl.validateS3Obj(obj) == false {
 		return nil, ErrBadParameter
 	}
 
-	input := &s3.HeadObjectInput{
-		Bucket: aws.String(obj.BucketName()),
-		Key:    aws.String(obj.KeyName()),
+	impl.logInfo(fmt.Sprintf("streaming get from s3://%s/%s", obj.BucketName(), obj.KeyName()))
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+	}
+	if len(byteRange) != 0 {
+		input.Range = aws.String(byteRange)
+	}
+	if len(etag) != 0 {
+		input.IfMatch = aws.String(fmt.Sprintf("\"%s\"", etag))
 	}
 
-	result, err := impl.svc.HeadObject(input)
+	result, err := impl.svc.GetObjectWithContext(ctx, input)
+
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
-			case "NotFound":
-				//log.Printf("ERROR: bucket/key does not exist (%s)", aerr.Error())
+			case s3.ErrCodeNoSuchBucket:
 				return nil, ErrNotFound
+			case s3.ErrCodeNoSuchKey:
+				return nil, ErrNotFound
+			case "NoSuchVersion":
+				return nil, ErrNotFound
+			case s3.ErrCodeInvalidObjectState:
+				return nil, ErrObjectInGlacier
+			case "InvalidRange":
+				return nil, ErrInvalidRange
+			case "PreconditionFailed":
+				return nil, ErrObjectChanged
 			default:
 				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
 			}
 			return nil, aerr
 		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
 			impl.logError(fmt.Sprintf("%s", err.Error()))
 			return nil, err
 		}
-		//} else {
-		//	log.Printf("INFO: %s", result)
 	}
 
-	o := uvaS3ObjectImpl{bucket: obj.BucketName(), key: obj.KeyName()}
-
-	// get object attributes
-	o.isGlacier = result.StorageClass != nil &&
-		(strings.HasPrefix(*result.StorageClass, "GLACIER") && *result.StorageClass != "GLACIER_IR")
-	o.isRestoring = result.Restore != nil && strings.HasPrefix(*result.Restore, "ongoing-request=\"true\"")
-	o.isRestored = result.Restore != nil && strings.HasPrefix(*result.Restore, "ongoing-request=\"false\"")
-	o.size = *result.ContentLength
-	o.lastModified = *result.LastModified
+	return result.Body, nil
+}
 
-	return o, nil
+func (impl *uvaS3Impl) GetRange(obj UvaS3Object, offset int64, length int64) ([]byte, error) {
+	return impl.GetRangeWithContext(context.Background(), obj, offset, length)
 }
 
-func (impl *uvaS3Impl) RestoreObject(obj UvaS3Object, tier int, days int64) error {
+func (impl *uvaS3Impl) GetRangeWithContext(ctx context.Context, obj UvaS3Object, offset int64, length int64) ([]byte, error) {
 
 	// validate inbound parameters
-	if impl.validateS3Obj(obj) == false {
-		return ErrBadParameter
+	byteRange, ok := rangeHeader(offset, length)
+	if impl.validateS3Obj(obj) == false || ok == false {
+		return nil, ErrBadParameter
 	}
 
-	tierStr := ""
-	switch tier {
-	case RESTORE_EXPEDITED:
-		tierStr = "Expedited"
-	case RESTORE_STANDARD:
-		tierStr = "Standard"
-	case RESTORE_BULK:
-		tierStr = "Bulk"
-	default:
-		return ErrBadParameter
+	// if we already know the size we can reject ranges that start beyond the end of the object
+	if obj.Size() != -1 && offset >= 0 && offset >= obj.Size() {
+		return nil, ErrInvalidRange
 	}
 
-	impl.logInfo(fmt.Sprintf("restoring: s3://%s/%s tier: %s, %d for days", obj.BucketName(), obj.KeyName(), tierStr, days))
+	start := time.Now()
 
-	input := &s3.RestoreObjectInput{
-		Bucket: aws.String(obj.BucketName()),
-		Key:    aws.String(obj.KeyName()),
-		RestoreRequest: &s3.RestoreRequest{
-			Days: aws.Int64(days),
-			GlacierJobParameters: &s3.GlacierJobParameters{
-				Tier: aws.String(tierStr),
-			},
-		},
+	reader, err := impl.getReader(ctx, obj, byteRange, "")
+
+	// optionally restore archived objects and try again
+	if err == ErrObjectInGlacier && impl.config.AutoRestore == true {
+		err = impl.autoRestore(ctx, obj)
+		if err == nil {
+			reader, err = impl.getReader(ctx, obj, byteRange, "")
+		}
 	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 
-	_, err := impl.svc.RestoreObject(input)
+	buf, err := io.ReadAll(reader)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			//case s3.ErrCodeObjectAlreadyInActiveTierError:
-			//	log.Printf("ERROR: already restored (%s)", aerr.Error())
-			case s3.ErrCodeInvalidObjectState:
-				//log.Printf("ERROR: inappropriate storage class for restore (%s)", aerr.Error())
-				return ErrCannotRestore
-			case s3.ErrCodeNoSuchBucket:
-				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
-				return ErrNotFound
-			case s3.ErrCodeNoSuchKey:
-				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
-				return ErrNotFound
-			default:
-				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
-			}
-			return aerr
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			impl.logError(fmt.Sprintf("%s", err.Error()))
-			return err
-		}
-		//} else {
-		//log.Printf("INFO: %s", result)
+		impl.logError(fmt.Sprintf("%s", err.Error()))
+		return nil, err
 	}
-	return nil
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("get of s3://%s/%s %s complete in %0.2f seconds (%d bytes)", obj.BucketName(), obj.KeyName(), byteRange, duration.Seconds(), len(buf)))
+
+	return buf, nil
 }
 
-func (impl *uvaS3Impl) DeleteObject(obj UvaS3Object) error {
+func (impl *uvaS3Impl) PutFromReader(obj UvaS3Object, reader io.Reader) error {
+	return impl.PutFromReaderWithOptions(obj, reader, UvaS3PutOptions{})
+}
 
-	// validate inbound parameters
-	if impl.validateS3Obj(obj) == false {
+func (impl *uvaS3Impl) PutFromReaderWithOptions(obj UvaS3Object, reader io.Reader, options UvaS3PutOptions) error {
+	return impl.PutFromReaderWithOptionsContext(context.Background(), obj, reader, options)
+}
+
+func (impl *uvaS3Impl) PutFromReaderWithContext(ctx context.Context, obj UvaS3Object, reader io.Reader) error {
+	return impl.PutFromReaderWithOptionsContext(ctx, obj, reader, UvaS3PutOptions{})
+}
+
+func (impl *uvaS3Impl) PutFromReaderWithOptionsContext(ctx context.Context, obj UvaS3Object, reader io.Reader, options UvaS3PutOptions) error {
+
+	// validate inbound parameters, we cannot compute a checksum before uploading a stream
+	if impl.validateS3Obj(obj) == false || reader == nil || validPutOptions(options) == false || len(options.Checksum) != 0 {
 		return ErrBadParameter
 	}
 
-	impl.logInfo(fmt.Sprintf("deleting s3://%s/%s", obj.BucketName(), obj.KeyName()))
+	bucket := obj.BucketName()
+	key := obj.KeyName()
+	impl.logInfo(fmt.Sprintf("streaming put to s3://%s/%s", bucket, key))
+
+	// count and hash the bytes as they go past, hiding any Seek method so the uploader never tries to determine
+	// the size
+	counter := newCountingReader(reader, streamPartSize)
+	upParams := &s3manager.UploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   counter,
+	}
+	applyPutOptions(upParams, options)
 
 	start := time.Now()
-	_, err := impl.svc.DeleteObject(
-		&s3.DeleteObjectInput{
-			Bucket: aws.String(obj.BucketName()),
-			Key:    aws.String(obj.KeyName()),
-		})
+
+	// the uploader reads the stream one part at a time, buffering at most a part per concurrent upload
+	result, err := impl.uploader.UploadWithContext(ctx, upParams, func(u *s3manager.Uploader) {
+		u.PartSize = streamPartSize
+		u.Concurrency = streamConcurrency
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchBucket:
-				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
-				return ErrNotFound
-			case s3.ErrCodeNoSuchKey:
-				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
 				return ErrNotFound
-			//case s3.ErrCodeInvalidObjectState:
-			//	log.Printf("ERROR: inappropriate storage class for get (%s)", aerr.Error())
 			default:
 				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
 			}
 			return aerr
 		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
 			impl.logError(fmt.Sprintf("%s", err.Error()))
 			return err
 		}
-		//} else {
-		//log.Printf("INFO: %s", result)
+	}
+
+	err = impl.verifyUploadETag(ctx, obj, result, counter.etag(len(result.UploadID) != 0))
+	if err != nil {
+		return err
 	}
 
 	duration := time.Since(start)
-	impl.logInfo(fmt.Sprintf("delete of s3://%s/%s complete in %0.2f seconds", obj.BucketName(), obj.KeyName(), duration.Seconds()))
+	impl.logInfo(fmt.Sprintf("put of s3://%s/%s complete in %0.2f seconds (%d bytes, %0.2f bytes/sec)", bucket, key, duration.Seconds(), counter.count, float64(counter.count)/duration.Seconds()))
+
 	return nil
 }
 
-//
-// helpers
-//
-
-func (impl *uvaS3Impl) logInfo(message string) {
-	if impl.config.Logging == true {
-		log.Printf("INFO: %s", message)
-	}
+func (impl *uvaS3Impl) OpenObject(obj UvaS3Object) (UvaS3ObjectReader, error) {
+	return impl.OpenObjectWithOptions(obj, UvaS3ReaderOptions{})
 }
 
-func (impl *uvaS3Impl) logWarn(message string) {
-	if impl.config.Logging == true {
-		log.Printf("WARNING: %s", message)
-	}
+func (impl *uvaS3Impl) OpenObjectWithOptions(obj UvaS3Object, options UvaS3ReaderOptions) (UvaS3ObjectReader, error) {
+	return impl.OpenObjectWithOptionsContext(context.Background(), obj, options)
 }
 
-func (impl *uvaS3Impl) logError(message string) {
-	if impl.config.Logging == true {
-		log.Printf("ERROR: %s", message)
-	}
+func (impl *uvaS3Impl) OpenObjectWithContext(ctx context.Context, obj UvaS3Object) (UvaS3ObjectReader, error) {
+	return impl.OpenObjectWithOptionsContext(ctx, obj, UvaS3ReaderOptions{})
 }
 
-func (impl *uvaS3Impl) validateS3Obj(o UvaS3Object) bool {
-	if len(o.BucketName()) == 0 || len(o.KeyName()) == 0 {
+func (impl *uvaS3Impl) OpenObjectWithOptionsContext(ctx context.Context, obj UvaS3Object, options UvaS3ReaderOptions) (UvaS3ObjectReader, error) {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return nil, ErrBadParameter
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// archived objects must be restored before they can be read
+	if s.IsGlacier() == true && s.IsRestored() == false {
+		if impl.config.AutoRestore == false {
+			return nil, ErrObjectInGlacier
+		}
+		err = impl.autoRestore(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		s, err = impl.StatObjectWithContext(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	impl.logInfo(fmt.Sprintf("open s3://%s/%s (%d bytes)", obj.BucketName(), obj.KeyName(), s.Size()))
+
+	// every ranged get must see the object as it was when we opened it
+	etag := s.ETag()
+	return newUvaS3ObjectReader(ctx, s.Size(), options, func(ctx context.Context, byteRange string) (io.ReadCloser, error) {
+		return impl.getReader(ctx, obj, byteRange, etag)
+	})
+}
+
+func (impl *uvaS3Impl) StatObject(obj UvaS3Object) (UvaS3Object, error) {
+	return impl.StatObjectWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) StatObjectWithContext(ctx context.Context, obj UvaS3Object) (UvaS3Object, error) {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return nil, ErrBadParameter
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(obj.BucketName()),
+		Key:          aws.String(obj.KeyName()),
+		VersionId:    versionId(obj),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	}
+
+	result, err := impl.svc.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "NotFound":
+				//log.Printf("ERROR: bucket/key does not exist (%s)", aerr.Error())
+				return nil, ErrNotFound
+			case "MethodNotAllowed":
+				// the specified version is a delete marker
+				return nil, ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return nil, aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return nil, err
+		}
+		//} else {
+		//	log.Printf("INFO: %s", result)
+	}
+
+	o := uvaS3ObjectImpl{bucket: obj.BucketName(), key: obj.KeyName(), versionId: aws.StringValue(result.VersionId)}
+
+	// get object attributes, intelligent tiering objects in the archive tiers must be restored too
+	o.archiveStatus = aws.StringValue(result.ArchiveStatus)
+	o.isGlacier = isGlacierStorageClass(result.StorageClass) || len(o.archiveStatus) != 0
+
+	// the restore header looks like: ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+	if result.Restore != nil {
+		attribs := parseHeaderAttributes(*result.Restore)
+		o.isRestoring = attribs["ongoing-request"] == "true"
+		o.isRestored = attribs["ongoing-request"] == "false"
+		o.restoreExpiry, _ = time.Parse(time.RFC1123, attribs["expiry-date"])
+	}
+
+	o.size = *result.ContentLength
+	o.lastModified = *result.LastModified
+	o.etag = unquoteETag(result.ETag)
+	o.storageClass = storageClass(result.StorageClass)
+	o.contentType = aws.StringValue(result.ContentType)
+	o.metadata = make(map[string]string)
+	for k, v := range result.Metadata {
+		// the SDK canonicalizes the header names, S3 stores them in lower case
+		o.metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+	o.sse = aws.StringValue(result.ServerSideEncryption)
+	o.sseKmsKeyId = aws.StringValue(result.SSEKMSKeyId)
+	o.replicationStatus = aws.StringValue(result.ReplicationStatus)
+	o.checksums = headChecksums(result)
+	o.headed = true
+
+	// the expiration header looks like: expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="rule-name"
+	if result.Expiration != nil {
+		attribs := parseHeaderAttributes(*result.Expiration)
+		o.expiryDate, _ = time.Parse(time.RFC1123, attribs["expiry-date"])
+		o.expiryRule = attribs["rule-id"]
+	}
+
+	return o, nil
+}
+
+func (impl *uvaS3Impl) RestoreObject(obj UvaS3Object, tier int, days int64) error {
+	return impl.RestoreObjectWithContext(context.Background(), obj, tier, days)
+}
+
+func (impl *uvaS3Impl) RestoreObjectWithContext(ctx context.Context, obj UvaS3Object, tier int, days int64) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return ErrBadParameter
+	}
+
+	if restoreTierName(tier) == "" {
+		return ErrBadParameter
+	}
+
+	// ensure the tier is appropriate for the storage class
+	target, err := impl.restoreTarget(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if validRestoreTier(target, tier) == false {
+		return ErrTierNotSupported
+	}
+
+	err = impl.restoreRequest(ctx, target, tier, days)
+
+	// expedited retrievals are subject to available capacity so optionally try again using a standard retrieval
+	if err == ErrExpeditedUnavailable && impl.config.ExpeditedFallback == true {
+		impl.logWarn(fmt.Sprintf("expedited restore of s3://%s/%s unavailable, falling back to standard", obj.BucketName(), obj.KeyName()))
+		err = impl.restoreRequest(ctx, target, RESTORE_STANDARD, days)
+	}
+	return err
+}
+
+func (impl *uvaS3Impl) UpgradeRestore(obj UvaS3Object, tier int, days int64) error {
+	return impl.UpgradeRestoreWithContext(context.Background(), obj, tier, days)
+}
+
+func (impl *uvaS3Impl) UpgradeRestoreWithContext(ctx context.Context, obj UvaS3Object, tier int, days int64) error {
+
+	// validate inbound parameters, bulk is the slowest tier so can never be an upgrade
+	if impl.validateS3Obj(obj) == false || restoreTierName(tier) == "" || tier == RESTORE_BULK {
+		return ErrBadParameter
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	if s.IsGlacier() == false {
+		return ErrCannotRestore
+	}
+	if s.IsRestoring() == false {
+		return ErrNotRestoring
+	}
+	if validRestoreTier(s, tier) == false {
+		return ErrTierNotSupported
+	}
+
+	impl.logInfo(fmt.Sprintf("upgrading restore of s3://%s/%s to %s", obj.BucketName(), obj.KeyName(), restoreTierName(tier)))
+
+	// a restore request with a faster tier upgrades the in progress restore, S3 reports the request as
+	// already in progress when the tier is not faster
+	return impl.restoreRequest(ctx, s, tier, days)
+}
+
+func (impl *uvaS3Impl) DeleteObject(obj UvaS3Object) error {
+	return impl.DeleteObjectWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) DeleteObjectWithContext(ctx context.Context, obj UvaS3Object) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("deleting s3://%s/%s", obj.BucketName(), obj.KeyName()))
+
+	start := time.Now()
+	_, err := impl.svc.DeleteObjectWithContext(ctx,
+		&s3.DeleteObjectInput{
+			Bucket:    aws.String(obj.BucketName()),
+			Key:       aws.String(obj.KeyName()),
+			VersionId: versionId(obj),
+		})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			case s3.ErrCodeNoSuchKey:
+				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			case "NoSuchVersion":
+				return ErrNotFound
+			//case s3.ErrCodeInvalidObjectState:
+			//	log.Printf("ERROR: inappropriate storage class for get (%s)", aerr.Error())
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+		//} else {
+		//log.Printf("INFO: %s", result)
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("delete of s3://%s/%s complete in %0.2f seconds", obj.BucketName(), obj.KeyName(), duration.Seconds()))
+	return nil
+}
+
+func (impl *uvaS3Impl) ListObjects(bucket string, prefix string, delimiter string, fn func(UvaS3Object) bool) ([]string, error) {
+	return impl.ListObjectsWithContext(context.Background(), bucket, prefix, delimiter, fn)
+}
+
+func (impl *uvaS3Impl) ListObjectsWithContext(ctx context.Context, bucket string, prefix string, delimiter string, fn func(UvaS3Object) bool) ([]string, error) {
+
+	// validate inbound parameters
+	if len(bucket) == 0 || fn == nil {
+		return nil, ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("listing s3://%s/%s", bucket, prefix))
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		// so we can report the restore status the same way StatObject does
+		OptionalObjectAttributes: aws.StringSlice([]string{s3.OptionalObjectAttributesRestoreStatus}),
+	}
+	if len(prefix) != 0 {
+		input.Prefix = aws.String(prefix)
+	}
+	if len(delimiter) != 0 {
+		input.Delimiter = aws.String(delimiter)
+	}
+
+	start := time.Now()
+	count := 0
+	prefixes := make([]string, 0)
+	err := impl.svc.ListObjectsV2PagesWithContext(ctx, input,
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, cp := range page.CommonPrefixes {
+				prefixes = append(prefixes, aws.StringValue(cp.Prefix))
+			}
+			for _, entry := range page.Contents {
+				count++
+				if fn(newUvaS3ObjectFromListing(bucket, entry)) == false {
+					return false
+				}
+			}
+			return true
+		})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return nil, ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return nil, aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return nil, err
+		}
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("list of s3://%s/%s complete in %0.2f seconds (%d objects, %d prefixes)", bucket, prefix, duration.Seconds(), count, len(prefixes)))
+	return prefixes, nil
+}
+
+func (impl *uvaS3Impl) CreateBucket(bucket string, region string) error {
+	return impl.CreateBucketWithContext(context.Background(), bucket, region)
+}
+
+func (impl *uvaS3Impl) CreateBucketWithContext(ctx context.Context, bucket string, region string) error {
+
+	// validate inbound parameters
+	if len(bucket) == 0 {
+		return ErrBadParameter
+	}
+
+	// use the session region if one is not specified
+	if len(region) == 0 {
+		region = aws.StringValue(impl.sess.Config.Region)
+	}
+
+	// and we cannot create a bucket without knowing where
+	if len(region) == 0 {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("creating s3://%s in %s", bucket, region))
+
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	}
+
+	// us-east-1 is the default location and must not be specified as a constraint
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+
+	// the bucket must be created using an endpoint in the target region
+	svc := s3.New(impl.sess, aws.NewConfig().WithRegion(region))
+	_, err := svc.CreateBucketWithContext(ctx, input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeBucketAlreadyExists:
+				return ErrBucketExists
+			case s3.ErrCodeBucketAlreadyOwnedByYou:
+				return ErrBucketExists
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+	}
+	return nil
+}
+
+func (impl *uvaS3Impl) DeleteBucket(bucket string, empty bool) error {
+	return impl.DeleteBucketWithContext(context.Background(), bucket, empty)
+}
+
+func (impl *uvaS3Impl) DeleteBucketWithContext(ctx context.Context, bucket string, empty bool) error {
+
+	// validate inbound parameters
+	if len(bucket) == 0 {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("deleting s3://%s (empty first: %t)", bucket, empty))
+
+	if empty == true {
+		err := impl.emptyBucket(ctx, bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := impl.svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			case "BucketNotEmpty":
+				return ErrBucketNotEmpty
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+	}
+	return nil
+}
+
+func (impl *uvaS3Impl) BucketExists(bucket string) (bool, error) {
+	return impl.BucketExistsWithContext(context.Background(), bucket)
+}
+
+func (impl *uvaS3Impl) BucketExistsWithContext(ctx context.Context, bucket string) (bool, error) {
+
+	// validate inbound parameters
+	if len(bucket) == 0 {
+		return false, ErrBadParameter
+	}
+
+	_, err := impl.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "NotFound":
+				return false, nil
+			case s3.ErrCodeNoSuchBucket:
+				return false, nil
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return false, aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (impl *uvaS3Impl) ListBuckets() ([]string, error) {
+	return impl.ListBucketsWithContext(context.Background())
+}
+
+func (impl *uvaS3Impl) ListBucketsWithContext(ctx context.Context) ([]string, error) {
+
+	result, err := impl.svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			return nil, aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return nil, err
+		}
+	}
+
+	buckets := make([]string, 0, len(result.Buckets))
+	for _, b := range result.Buckets {
+		buckets = append(buckets, aws.StringValue(b.Name))
+	}
+	return buckets, nil
+}
+
+func (impl *uvaS3Impl) ListObjectVersions(bucket string, prefix string, fn func(UvaS3Object) bool) error {
+	return impl.ListObjectVersionsWithContext(context.Background(), bucket, prefix, fn)
+}
+
+func (impl *uvaS3Impl) ListObjectVersionsWithContext(ctx context.Context, bucket string, prefix string, fn func(UvaS3Object) bool) error {
+
+	// validate inbound parameters
+	if len(bucket) == 0 || fn == nil {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("listing versions of s3://%s/%s", bucket, prefix))
+
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	}
+	if len(prefix) != 0 {
+		input.Prefix = aws.String(prefix)
+	}
+
+	start := time.Now()
+	count := 0
+	err := impl.svc.ListObjectVersionsPagesWithContext(ctx, input,
+		func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+
+			// versions and delete markers are reported separately so merge them back
+			// into key order, newest first
+			entries := make([]uvaS3ObjectImpl, 0, len(page.Versions)+len(page.DeleteMarkers))
+			for _, v := range page.Versions {
+				o := uvaS3ObjectImpl{bucket: bucket, key: aws.StringValue(v.Key)}
+				o.versionId = aws.StringValue(v.VersionId)
+				o.isLatest = aws.BoolValue(v.IsLatest)
+				o.isGlacier = isGlacierStorageClass(v.StorageClass)
+				o.storageClass = storageClass(v.StorageClass)
+				o.size = aws.Int64Value(v.Size)
+				o.lastModified = aws.TimeValue(v.LastModified)
+				o.etag = unquoteETag(v.ETag)
+				entries = append(entries, o)
+			}
+			for _, m := range page.DeleteMarkers {
+				o := uvaS3ObjectImpl{bucket: bucket, key: aws.StringValue(m.Key)}
+				o.versionId = aws.StringValue(m.VersionId)
+				o.isLatest = aws.BoolValue(m.IsLatest)
+				o.isDelete = true
+				o.lastModified = aws.TimeValue(m.LastModified)
+				entries = append(entries, o)
+			}
+			sort.SliceStable(entries, func(i, j int) bool {
+				if entries[i].key != entries[j].key {
+					return entries[i].key < entries[j].key
+				}
+				return entries[i].lastModified.After(entries[j].lastModified)
+			})
+
+			for _, o := range entries {
+				count++
+				if fn(o) == false {
+					return false
+				}
+			}
+			return true
+		})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("list of versions of s3://%s/%s complete in %0.2f seconds (%d versions)", bucket, prefix, duration.Seconds(), count))
+	return nil
+}
+
+func (impl *uvaS3Impl) UndeleteObject(obj UvaS3Object) (UvaS3Object, error) {
+	return impl.UndeleteObjectWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) UndeleteObjectWithContext(ctx context.Context, obj UvaS3Object) (UvaS3Object, error) {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return nil, ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("undeleting s3://%s/%s", obj.BucketName(), obj.KeyName()))
+
+	// get the versions of this key, newest first
+	versions := make([]UvaS3Object, 0)
+	err := impl.ListObjectVersionsWithContext(ctx, obj.BucketName(), obj.KeyName(), func(o UvaS3Object) bool {
+		if o.KeyName() == obj.KeyName() {
+			versions = append(versions, o)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	markers, _, found := undeleteMarkers(versions)
+	if found == false {
+		// either the current version is not a delete marker or there is nothing beneath it to recover
+		if versions[0].IsDeleteMarker() == false {
+			return nil, ErrNotDeleted
+		}
+		return nil, ErrNotFound
+	}
+
+	return impl.removeDeleteMarkers(ctx, obj.BucketName(), obj.KeyName(), markers)
+}
+
+func (impl *uvaS3Impl) UndeleteObjects(bucket string, prefix string, since time.Time) ([]UvaS3Object, error) {
+	return impl.UndeleteObjectsWithContext(context.Background(), bucket, prefix, since)
+}
+
+func (impl *uvaS3Impl) UndeleteObjectsWithContext(ctx context.Context, bucket string, prefix string, since time.Time) ([]UvaS3Object, error) {
+
+	// validate inbound parameters
+	if len(bucket) == 0 {
+		return nil, ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("undeleting s3://%s/%s (deleted since %s)", bucket, prefix, since.Format(time.RFC3339)))
+
+	// versions are listed in key order so we gather each key in turn and note the ones to recover.
+	// we do not remove anything until the listing is complete so we do not disturb the pagination
+	candidates := make(map[string][]UvaS3Object)
+	keys := make([]string, 0)
+	current := make([]UvaS3Object, 0)
+	evaluate := func() {
+		if len(current) == 0 {
+			return
+		}
+		markers, deleted, found := undeleteMarkers(current)
+		if found == true && deleted.After(since) {
+			key := current[0].KeyName()
+			candidates[key] = markers
+			keys = append(keys, key)
+		}
+		current = make([]UvaS3Object, 0)
+	}
+
+	err := impl.ListObjectVersionsWithContext(ctx, bucket, prefix, func(o UvaS3Object) bool {
+		if len(current) != 0 && current[0].KeyName() != o.KeyName() {
+			evaluate()
+		}
+		current = append(current, o)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	evaluate()
+
+	recovered := make([]UvaS3Object, 0, len(keys))
+	for _, key := range keys {
+		o, err := impl.removeDeleteMarkers(ctx, bucket, key, candidates[key])
+		if err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, o)
+	}
+
+	impl.logInfo(fmt.Sprintf("undelete of s3://%s/%s complete (%d objects)", bucket, prefix, len(recovered)))
+	return recovered, nil
+}
+
+func (impl *uvaS3Impl) DeleteObjects(objs []UvaS3Object) ([]UvaS3DeleteResult, error) {
+	return impl.DeleteObjectsWithContext(context.Background(), objs)
+}
+
+func (impl *uvaS3Impl) DeleteObjectsWithContext(ctx context.Context, objs []UvaS3Object) ([]UvaS3DeleteResult, error) {
+
+	// validate inbound parameters
+	for _, o := range objs {
+		if o == nil || impl.validateS3Obj(o) == false {
+			return nil, ErrBadParameter
+		}
+	}
+
+	impl.logInfo(fmt.Sprintf("deleting %d objects", len(objs)))
+
+	// the multi-delete API works on a single bucket so group by bucket and then split into chunks
+	type chunk struct {
+		bucket  string
+		indexes []int
+	}
+	chunks := make([]chunk, 0)
+	byBucket := make(map[string][]int)
+	buckets := make([]string, 0)
+	for ix, o := range objs {
+		if _, ok := byBucket[o.BucketName()]; ok == false {
+			buckets = append(buckets, o.BucketName())
+		}
+		byBucket[o.BucketName()] = append(byBucket[o.BucketName()], ix)
+	}
+	for _, b := range buckets {
+		indexes := byBucket[b]
+		for len(indexes) > 0 {
+			n := len(indexes)
+			if n > deleteBatchSize {
+				n = deleteBatchSize
+			}
+			chunks = append(chunks, chunk{bucket: b, indexes: indexes[:n]})
+			indexes = indexes[n:]
+		}
+	}
+
+	results := make([]UvaS3DeleteResult, len(objs))
+	for ix, o := range objs {
+		results[ix].Object = o
+	}
+
+	start := time.Now()
+
+	// each chunk owns its results so no locking is necessary. Failures are reported per object so every chunk
+	// is attempted, even once the context is done
+	_ = forEachConcurrently(context.Background(), len(chunks), deleteConcurrency, func(_ context.Context, cx int) error {
+		c := chunks[cx]
+		chunkObjs := make([]UvaS3Object, 0, len(c.indexes))
+		for _, ix := range c.indexes {
+			chunkObjs = append(chunkObjs, objs[ix])
+		}
+		errs := impl.deleteObjectChunk(ctx, c.bucket, chunkObjs)
+		for i, ix := range c.indexes {
+			results[ix].Err = errs[i]
+		}
+		return nil
+	})
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("delete of %d objects complete in %0.2f seconds (%d failed)", len(objs), duration.Seconds(), failed))
+	return results, nil
+}
+
+func (impl *uvaS3Impl) CopyObject(src UvaS3Object, dst UvaS3Object, options UvaS3CopyOptions) error {
+	return impl.CopyObjectWithContext(context.Background(), src, dst, options)
+}
+
+func (impl *uvaS3Impl) CopyObjectWithContext(ctx context.Context, src UvaS3Object, dst UvaS3Object, options UvaS3CopyOptions) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(src) == false || impl.validateS3Obj(dst) == false {
+		return ErrBadParameter
+	}
+
+	source := fmt.Sprintf("s3://%s/%s", src.BucketName(), src.KeyName())
+	destination := fmt.Sprintf("s3://%s/%s", dst.BucketName(), dst.KeyName())
+
+	impl.logInfo(fmt.Sprintf("copy %s to %s", source, destination))
+
+	start := time.Now()
+
+	// we need the source attributes to preserve them and to decide how to copy
+	head, err := impl.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(src.BucketName()),
+		Key:       aws.String(src.KeyName()),
+		VersionId: versionId(src),
+	})
+
+	if err == nil {
+		_, err = impl.copyObject(ctx, src, head, dst, options)
+	}
+
+	if err != nil {
+		return impl.copyError(err)
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("copy %s to %s complete in %0.2f seconds (%d bytes)", source, destination, duration.Seconds(), aws.Int64Value(head.ContentLength)))
+	return nil
+}
+
+func (impl *uvaS3Impl) MoveObject(src UvaS3Object, dst UvaS3Object) error {
+	return impl.MoveObjectWithContext(context.Background(), src, dst)
+}
+
+func (impl *uvaS3Impl) MoveObjectWithContext(ctx context.Context, src UvaS3Object, dst UvaS3Object) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(src) == false || impl.validateS3Obj(dst) == false {
+		return ErrBadParameter
+	}
+
+	// moving an object onto itself would delete it
+	if src.BucketName() == dst.BucketName() && src.KeyName() == dst.KeyName() {
+		return ErrBadParameter
+	}
+
+	source := fmt.Sprintf("s3://%s/%s", src.BucketName(), src.KeyName())
+	destination := fmt.Sprintf("s3://%s/%s", dst.BucketName(), dst.KeyName())
+
+	impl.logInfo(fmt.Sprintf("move %s to %s", source, destination))
+
+	start := time.Now()
+	head, err := impl.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(src.BucketName()),
+		Key:       aws.String(src.KeyName()),
+		VersionId: versionId(src),
+	})
+	if err != nil {
+		return impl.copyError(err)
+	}
+
+	// the copy only succeeds if the source is still the object we have the attributes of
+	copied, err := impl.copyObject(ctx, src, head, dst, UvaS3CopyOptions{})
+	if err != nil {
+		return impl.copyError(err)
+	}
+
+	// verify the copy before we remove the source
+	d, err := impl.StatObjectWithContext(ctx, NewUvaS3Object(dst.BucketName(), dst.KeyName()))
+	if err != nil {
+		return err
+	}
+
+	size := aws.Int64Value(head.ContentLength)
+	if d.Size() != size {
+		impl.logError(fmt.Sprintf("move %s to %s: expected %d bytes, copied %d bytes", source, destination, size, d.Size()))
+		return ErrCopyVerifyFailed
+	}
+
+	// the destination must be the object we created
+	if d.ETag() != copied {
+		impl.logError(fmt.Sprintf("move %s to %s: expected etag %s, found etag %s", source, destination, copied, d.ETag()))
+		return ErrCopyVerifyFailed
+	}
+
+	// and a single request copy keeps the entity tag when both are a simple MD5 of the content, a multipart
+	// copy has a new entity tag so we rely on the size
+	etag := unquoteETag(head.ETag)
+	if size <= maxCopyObjectSize && isMD5ETag(d) == true && isMultipartETag(etag) == false &&
+		strings.HasPrefix(aws.StringValue(head.ServerSideEncryption), "aws:kms") == false && d.ETag() != etag {
+		impl.logError(fmt.Sprintf("move %s to %s: expected etag %s, copied etag %s", source, destination, etag, d.ETag()))
+		return ErrCopyVerifyFailed
+	}
+
+	err = impl.DeleteObjectWithContext(ctx, src)
+	if err != nil {
+		impl.logError(fmt.Sprintf("move %s to %s: source delete failed (%s)", source, destination, err.Error()))
+		return ErrSourceNotDeleted
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("move %s to %s complete in %0.2f seconds", source, destination, duration.Seconds()))
+	return nil
+}
+
+func (impl *uvaS3Impl) ChangeStorageClass(obj UvaS3Object, storageClass UvaS3StorageClass) error {
+	return impl.ChangeStorageClassWithContext(context.Background(), obj, storageClass)
+}
+
+func (impl *uvaS3Impl) ChangeStorageClassWithContext(ctx context.Context, obj UvaS3Object, storageClass UvaS3StorageClass) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false || validStorageClass(storageClass) == false {
+		return ErrBadParameter
+	}
+
+	source := fmt.Sprintf("s3://%s/%s", obj.BucketName(), obj.KeyName())
+
+	impl.logInfo(fmt.Sprintf("changing storage class of %s to %s", source, storageClass))
+
+	start := time.Now()
+	head, err := impl.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(obj.BucketName()),
+		Key:    aws.String(obj.KeyName()),
+	})
+	if err != nil {
+		return impl.copyError(err)
+	}
+
+	// the copy becomes the current version so copying any other version would revert the object
+	if len(obj.VersionId()) != 0 && obj.VersionId() != aws.StringValue(head.VersionId) {
+		impl.logError(fmt.Sprintf("%s version %s is not the current version", source, obj.VersionId()))
+		return ErrBadParameter
+	}
+
+	// S3 refuses to copy an object onto itself without changing anything
+	current := STORAGE_CLASS_STANDARD
+	if head.StorageClass != nil {
+		current = UvaS3StorageClass(*head.StorageClass)
+	}
+	if current == storageClass {
+		impl.logInfo(fmt.Sprintf("%s is already %s", source, storageClass))
+		return nil
+	}
+
+	// copy the current version onto itself with the new storage class
+	_, err = impl.copyObject(ctx, obj, head, NewUvaS3Object(obj.BucketName(), obj.KeyName()), UvaS3CopyOptions{StorageClass: storageClass})
+	if err != nil {
+		return impl.copyError(err)
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("change of storage class of %s from %s to %s complete in %0.2f seconds", source, current, storageClass, duration.Seconds()))
+	return nil
+}
+
+func (impl *uvaS3Impl) GetObjectTags(obj UvaS3Object) (map[string]string, error) {
+	return impl.GetObjectTagsWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) GetObjectTagsWithContext(ctx context.Context, obj UvaS3Object) (map[string]string, error) {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return nil, ErrBadParameter
+	}
+
+	result, err := impl.svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+	})
+	if err != nil {
+		return nil, impl.taggingError(err)
+	}
+
+	tags := make(map[string]string)
+	for _, t := range result.TagSet {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return tags, nil
+}
+
+func (impl *uvaS3Impl) PutObjectTags(obj UvaS3Object, tags map[string]string) error {
+	return impl.PutObjectTagsWithContext(context.Background(), obj, tags)
+}
+
+func (impl *uvaS3Impl) PutObjectTagsWithContext(ctx context.Context, obj UvaS3Object, tags map[string]string) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false || tags == nil {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("tagging s3://%s/%s (%d tags)", obj.BucketName(), obj.KeyName(), len(tags)))
+
+	tagSet := make([]*s3.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	_, err := impl.svc.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+		Tagging:   &s3.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return impl.taggingError(err)
+	}
+	return nil
+}
+
+func (impl *uvaS3Impl) DeleteObjectTags(obj UvaS3Object) error {
+	return impl.DeleteObjectTagsWithContext(context.Background(), obj)
+}
+
+func (impl *uvaS3Impl) DeleteObjectTagsWithContext(ctx context.Context, obj UvaS3Object) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false {
+		return ErrBadParameter
+	}
+
+	impl.logInfo(fmt.Sprintf("removing tags from s3://%s/%s", obj.BucketName(), obj.KeyName()))
+
+	_, err := impl.svc.DeleteObjectTaggingWithContext(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+	})
+	if err != nil {
+		return impl.taggingError(err)
+	}
+	return nil
+}
+
+func (impl *uvaS3Impl) ExtendRestore(obj UvaS3Object, days int64) error {
+	return impl.ExtendRestoreWithContext(context.Background(), obj, days)
+}
+
+func (impl *uvaS3Impl) ExtendRestoreWithContext(ctx context.Context, obj UvaS3Object, days int64) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false || days <= 0 {
+		return ErrBadParameter
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	if s.IsGlacier() == false {
+		return ErrCannotRestore
+	}
+	if s.IsRestored() == false {
+		return ErrNotRestored
+	}
+
+	impl.logInfo(fmt.Sprintf("extending restore of s3://%s/%s (currently expires %s) to %d days", obj.BucketName(), obj.KeyName(), s.RestoreExpiry().Format(time.RFC3339), days))
+
+	// restoring an already restored object only updates the expiry, the tier is irrelevant
+	return impl.RestoreObjectWithContext(ctx, obj, RESTORE_STANDARD, days)
+}
+
+func (impl *uvaS3Impl) WaitForRestore(ctx context.Context, obj UvaS3Object, policy UvaS3PollPolicy) (UvaS3Object, error) {
+
+	// validate inbound parameters
+	if ctx == nil || impl.validateS3Obj(obj) == false || policy.Timeout < 0 {
+		return nil, ErrBadParameter
+	}
+
+	policy = pollPolicyDefaults(policy)
+	if policy.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	source := fmt.Sprintf("s3://%s/%s", obj.BucketName(), obj.KeyName())
+	start := time.Now()
+	interval := policy.InitialInterval
+	for {
+		s, err := impl.StatObjectWithContext(ctx, obj)
+		if err != nil {
+			// the deadline may pass while we are checking
+			return nil, restoreWaitError(ctx, err)
+		}
+
+		// objects that are not archived are always available
+		if s.IsGlacier() == false || s.IsRestored() == true {
+			duration := time.Since(start)
+			impl.logInfo(fmt.Sprintf("restore of %s complete after %0.2f seconds", source, duration.Seconds()))
+			return s, nil
+		}
+
+		// nothing to wait for
+		if s.IsRestoring() == false {
+			return nil, ErrNotRestoring
+		}
+
+		impl.logInfo(fmt.Sprintf("restore of %s in progress, checking again in %s", source, interval))
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, restoreWaitError(ctx, ctx.Err())
+		case <-timer.C:
+		}
+
+		interval = nextPollInterval(policy, interval)
+	}
+}
+
+//
+// helpers
+//
+
+func (impl *uvaS3Impl) logInfo(message string) {
+	if impl.config.Logging == true {
+		log.Printf("INFO: %s", message)
+	}
+}
+
+func (impl *uvaS3Impl) logWarn(message string) {
+	if impl.config.Logging == true {
+		log.Printf("WARNING: %s", message)
+	}
+}
+
+func (impl *uvaS3Impl) logError(message string) {
+	if impl.config.Logging == true {
+		log.Printf("ERROR: %s", message)
+	}
+}
+
+func (impl *uvaS3Impl) validateS3Obj(o UvaS3Object) bool {
+	if len(o.BucketName()) == 0 || len(o.KeyName()) == 0 {
+		return false
+	}
+	return true
+}
+
+// delete every object version and delete marker in the bucket so it can be removed
+func (impl *uvaS3Impl) emptyBucket(ctx context.Context, bucket string) error {
+
+	var deleteErr error
+	count := 0
+	err := impl.svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)},
+		func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+
+			// a page contains at most 1000 entries which is also the multi-delete limit
+			ids := make([]*s3.ObjectIdentifier, 0, len(page.Versions)+len(page.DeleteMarkers))
+			for _, v := range page.Versions {
+				ids = append(ids, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+			for _, m := range page.DeleteMarkers {
+				ids = append(ids, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+			}
+			if len(ids) == 0 {
+				return true
+			}
+
+			result, err := impl.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				deleteErr = err
+				return false
+			}
+			if len(result.Errors) != 0 {
+				e := result.Errors[0]
+				deleteErr = awserr.New(aws.StringValue(e.Code), fmt.Sprintf("%s (%s)", aws.StringValue(e.Message), aws.StringValue(e.Key)), nil)
+				return false
+			}
+			count += len(ids)
+			return true
+		})
+
+	if err == nil {
+		err = deleteErr
+	}
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+	}
+
+	impl.logInfo(fmt.Sprintf("emptied s3://%s (%d objects)", bucket, count))
+	return nil
+}
+
+// delete up to deleteBatchSize objects from a single bucket and return the error (or nil) for each one
+func (impl *uvaS3Impl) deleteObjectChunk(ctx context.Context, bucket string, objs []UvaS3Object) []error {
+
+	errs := make([]error, len(objs))
+	ids := make([]*s3.ObjectIdentifier, 0, len(objs))
+	for _, o := range objs {
+		ids = append(ids, &s3.ObjectIdentifier{Key: aws.String(o.KeyName()), VersionId: versionId(o)})
+	}
+
+	// quiet mode so the response only includes the failures
+	result, err := impl.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+	})
+
+	if err != nil {
+		// the entire request failed so every object in it failed
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				err = ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+		}
+		for ix := range errs {
+			errs[ix] = err
+		}
+		return errs
+	}
+
+	// map each failure back to the objects it refers to
+	for _, e := range result.Errors {
+		key := aws.StringValue(e.Key)
+		version := aws.StringValue(e.VersionId)
+		aerr := awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil)
+		impl.logError(fmt.Sprintf("deleting s3://%s/%s: %s (%s)", bucket, key, aerr.Code(), aerr.Message()))
+		for ix, o := range objs {
+			if o.KeyName() == key && o.VersionId() == version {
+				errs[ix] = aerr
+			}
+		}
+	}
+	return errs
+}
+
+// map the errors from a copy into our errors
+func (impl *uvaS3Impl) copyError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "NotFound":
+			//log.Printf("ERROR: bucket/key does not exist (%s)", aerr.Error())
+			return ErrNotFound
+		case "MethodNotAllowed":
+			// the specified version is a delete marker
+			return ErrNotFound
+		case s3.ErrCodeNoSuchBucket:
+			//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+			return ErrNotFound
+		case s3.ErrCodeNoSuchKey:
+			//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
+			return ErrNotFound
+		case "NoSuchVersion":
+			return ErrNotFound
+		case s3.ErrCodeInvalidObjectState:
+			//	log.Printf("ERROR: inappropriate storage class for copy (%s)", aerr.Error())
+			return ErrObjectInGlacier
+		case "PreconditionFailed":
+			// the source changed since we got its attributes
+			return ErrObjectChanged
+		default:
+			impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+		}
+		return aerr
+	}
+
+	if err != ErrObjectInGlacier {
+		// Print the error, cast err to awserr.Error to get the Code and
+		// Message from an error.
+		impl.logError(fmt.Sprintf("%s", err.Error()))
+	}
+	return err
+}
+
+// map the errors from the tagging operations into our errors
+func (impl *uvaS3Impl) taggingError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchBucket:
+			//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+			return ErrNotFound
+		case s3.ErrCodeNoSuchKey:
+			//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
+			return ErrNotFound
+		case "NoSuchVersion":
+			return ErrNotFound
+		case "MethodNotAllowed":
+			// the specified version is a delete marker
+			return ErrNotFound
+		default:
+			impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+		}
+		return aerr
+	}
+
+	// Print the error, cast err to awserr.Error to get the Code and
+	// Message from an error.
+	impl.logError(fmt.Sprintf("%s", err.Error()))
+	return err
+}
+
+// are the put options valid
+func validPutOptions(options UvaS3PutOptions) bool {
+	return (len(options.StorageClass) == 0 || validStorageClass(options.StorageClass) == true) &&
+		(len(options.Checksum) == 0 || validChecksumAlgorithm(options.Checksum) == true)
+}
+
+// apply the put options to the upload parameters
+func applyPutOptions(input *s3manager.UploadInput, options UvaS3PutOptions) {
+
+	if len(options.ContentType) != 0 {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if len(options.ContentDisposition) != 0 {
+		input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if len(options.CacheControl) != 0 {
+		input.CacheControl = aws.String(options.CacheControl)
+	}
+	if len(options.ContentEncoding) != 0 {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if len(options.Metadata) != 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+	if len(options.StorageClass) != 0 {
+		input.StorageClass = aws.String(string(options.StorageClass))
+	}
+
+	// tags are supplied as URL query parameters
+	if len(options.Tags) != 0 {
+		tags := url.Values{}
+		for k, v := range options.Tags {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+}
+
+// copy the source object (with the supplied attributes) to the destination, using a multipart copy when the
+// object is too large for a single request. The copy fails if the source no longer matches the attributes.
+// Returns the entity tag of the copy, errors are returned unmapped
+func (impl *uvaS3Impl) copyObject(ctx context.Context, src UvaS3Object, head *s3.HeadObjectOutput, dst UvaS3Object, options UvaS3CopyOptions) (string, error) {
+
+	// archived objects must be restored before they can be copied
+	if (isGlacierStorageClass(head.StorageClass) == true || head.ArchiveStatus != nil) &&
+		(head.Restore == nil || strings.HasPrefix(*head.Restore, "ongoing-request=\"false\"") == false) {
+		return "", ErrObjectInGlacier
+	}
+
+	// preserve the source storage class unless asked otherwise, S3 would otherwise use STANDARD
+	storageClass := head.StorageClass
+	if len(options.StorageClass) != 0 {
+		storageClass = aws.String(string(options.StorageClass))
+	}
+
+	metadata := head.Metadata
+	if options.ReplaceMetadata == true {
+		metadata = aws.StringMap(options.Metadata)
+	}
+
+	if aws.Int64Value(head.ContentLength) <= maxCopyObjectSize {
+		input := &s3.CopyObjectInput{
+			Bucket:       aws.String(dst.BucketName()),
+			Key:          aws.String(dst.KeyName()),
+			CopySource:   aws.String(copySource(src)),
+			StorageClass: storageClass,
+			// a copy uses the bucket default encryption unless we specify the source encryption
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+			// ensure the source has not changed since we got its attributes
+			CopySourceIfMatch: head.ETag,
+		}
+
+		if options.ReplaceMetadata == true {
+			// replacing the metadata replaces the content headers too so we must preserve them ourselves
+			input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+			input.Metadata = metadata
+			input.ContentType = head.ContentType
+			input.ContentDisposition = head.ContentDisposition
+			input.ContentEncoding = head.ContentEncoding
+			input.ContentLanguage = head.ContentLanguage
+			input.CacheControl = head.CacheControl
+		}
+
+		result, err := impl.svc.CopyObjectWithContext(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		return unquoteETag(result.CopyObjectResult.ETag), nil
+	}
+
+	// a multipart copy never copies the source attributes so we always specify them
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(dst.BucketName()),
+		Key:                  aws.String(dst.KeyName()),
+		StorageClass:         storageClass,
+		Metadata:             metadata,
+		ContentType:          head.ContentType,
+		ContentDisposition:   head.ContentDisposition,
+		ContentEncoding:      head.ContentEncoding,
+		ContentLanguage:      head.ContentLanguage,
+		CacheControl:         head.CacheControl,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+	}
+
+	// including the tags
+	tagging, err := impl.svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket:    aws.String(src.BucketName()),
+		Key:       aws.String(src.KeyName()),
+		VersionId: versionId(src),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(tagging.TagSet) != 0 {
+		tags := url.Values{}
+		for _, t := range tagging.TagSet {
+			tags.Set(aws.StringValue(t.Key), aws.StringValue(t.Value))
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+
+	create, err := impl.svc.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	var complete *s3.CompleteMultipartUploadOutput
+	parts, err := impl.copyParts(ctx, src, head, dst, aws.StringValue(create.UploadId))
+	if err == nil {
+		complete, err = impl.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(dst.BucketName()),
+			Key:             aws.String(dst.KeyName()),
+			UploadId:        create.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil {
+		// dont leave the parts we have copied lying around
+		// the context may already be cancelled so we abort without it
+		_, _ = impl.svc.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(dst.BucketName()),
+			Key:      aws.String(dst.KeyName()),
+			UploadId: create.UploadId,
+		})
+		return "", err
+	}
+	return unquoteETag(complete.ETag), nil
+}
+
+// copy the parts of a multipart copy concurrently and return the completed parts in order
+func (impl *uvaS3Impl) copyParts(ctx context.Context, src UvaS3Object, head *s3.HeadObjectOutput, dst UvaS3Object, uploadId string) ([]*s3.CompletedPart, error) {
+
+	size := aws.Int64Value(head.ContentLength)
+	partSize := copyPartSize
+	if size/partSize >= s3manager.MaxUploadParts {
+		partSize = (size / s3manager.MaxUploadParts) + 1
+	}
+	partCount := int((size + partSize - 1) / partSize)
+
+	impl.logInfo(fmt.Sprintf("multipart copy of %d bytes in %d parts", size, partCount))
+
+	// each part owns its slot in the result so no locking is necessary
+	parts := make([]*s3.CompletedPart, partCount)
+	err := forEachConcurrently(ctx, partCount, copyConcurrency, func(ctx context.Context, ix int) error {
+		first := int64(ix) * partSize
+		last := first + partSize - 1
+		if last >= size {
+			last = size - 1
+		}
+		result, err := impl.svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(dst.BucketName()),
+			Key:             aws.String(dst.KeyName()),
+			UploadId:        aws.String(uploadId),
+			PartNumber:      aws.Int64(int64(ix + 1)),
+			CopySource:      aws.String(copySource(src)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+			// ensure the source does not change while we are copying it
+			CopySourceIfMatch: head.ETag,
+		})
+		if err != nil {
+			return err
+		}
+		parts[ix] = &s3.CompletedPart{ETag: result.CopyPartResult.ETag, PartNumber: aws.Int64(int64(ix + 1))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// is the storage class one we know about
+func validStorageClass(storageClass UvaS3StorageClass) bool {
+	switch storageClass {
+	case STORAGE_CLASS_STANDARD, STORAGE_CLASS_REDUCED_REDUNDANCY, STORAGE_CLASS_STANDARD_IA,
+		STORAGE_CLASS_ONEZONE_IA, STORAGE_CLASS_INTELLIGENT_TIERING, STORAGE_CLASS_GLACIER_IR,
+		STORAGE_CLASS_GLACIER, STORAGE_CLASS_DEEP_ARCHIVE:
+		return true
+	}
+	return false
+}
+
+// apply the defaults to any unspecified poll policy values
+func pollPolicyDefaults(policy UvaS3PollPolicy) UvaS3PollPolicy {
+	if policy.InitialInterval <= 0 {
+		policy.InitialInterval = defaultPollInitialInterval
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = defaultPollMaxInterval
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = defaultPollMultiplier
+	}
+	return policy
+}
+
+// the poll interval following the current one
+func nextPollInterval(policy UvaS3PollPolicy, current time.Duration) time.Duration {
+	next := time.Duration(float64(current) * policy.Multiplier)
+	if next > policy.MaxInterval {
+		return policy.MaxInterval
+	}
+	return next
+}
+
+// do we have all the object attributes we validate a download against
+func hasAttributes(o UvaS3Object) bool {
+	impl, ok := o.(uvaS3ObjectImpl)
+	return ok == true && impl.headed == true
+}
+
+// entity tags are returned quoted
+func unquoteETag(etag *string) string {
+	return strings.Trim(aws.StringValue(etag), "\"")
+}
+
+// the entity tag of an object created by a multipart upload or copy is the hash of the part hashes
+// followed by the part count
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
+
+// the entity tag is the MD5 of the object content unless the object was created by a multipart upload or copy
+// or is encrypted using KMS
+func isMD5ETag(o UvaS3Object) bool {
+	return isMultipartETag(o.ETag()) == false && strings.HasPrefix(o.ServerSideEncryption(), "aws:kms") == false
+}
+
+// the storage class of an object, S3 omits it for STANDARD objects
+func storageClass(sc *string) UvaS3StorageClass {
+	if sc == nil || len(*sc) == 0 {
+		return STORAGE_CLASS_STANDARD
+	}
+	return UvaS3StorageClass(*sc)
+}
+
+// parse a header made of comma separated name="value" attributes (the values may contain commas)
+func parseHeaderAttributes(header string) map[string]string {
+
+	attribs := make(map[string]string)
+	remaining := header
+	for {
+		remaining = strings.TrimLeft(remaining, " ,")
+		eq := strings.Index(remaining, "=")
+		if eq == -1 {
+			return attribs
+		}
+		name := strings.TrimSpace(remaining[:eq])
+		remaining = remaining[eq+1:]
+
+		value := ""
+		if strings.HasPrefix(remaining, "\"") {
+			end := strings.Index(remaining[1:], "\"")
+			if end == -1 {
+				end = len(remaining) - 1
+			}
+			value = remaining[1 : end+1]
+			remaining = remaining[end+1:]
+			remaining = strings.TrimPrefix(remaining, "\"")
+		} else {
+			end := strings.Index(remaining, ",")
+			if end == -1 {
+				end = len(remaining)
+			}
+			value = strings.TrimSpace(remaining[:end])
+			remaining = remaining[end:]
+		}
+		attribs[name] = value
+	}
+}
+
+// the URL encoded copy source for an object
+func copySource(o UvaS3Object) string {
+	segments := strings.Split(o.KeyName(), "/")
+	for ix := range segments {
+		// encode '+' too as S3 may otherwise decode it as a space
+		segments[ix] = strings.ReplaceAll(url.QueryEscape(segments[ix]), "+", "%20")
+	}
+	source := fmt.Sprintf("%s/%s", o.BucketName(), strings.Join(segments, "/"))
+	if len(o.VersionId()) != 0 {
+		source = fmt.Sprintf("%s?versionId=%s", source, url.QueryEscape(o.VersionId()))
+	}
+	return source
+}
+
+// issue the restore request for an archived object
+func (impl *uvaS3Impl) restoreRequest(ctx context.Context, obj UvaS3Object, tier int, days int64) error {
+
+	tierStr := restoreTierName(tier)
+	impl.logInfo(fmt.Sprintf("restoring: s3://%s/%s tier: %s, %d for days", obj.BucketName(), obj.KeyName(), tierStr, days))
+
+	input := &s3.RestoreObjectInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+		RestoreRequest: &s3.RestoreRequest{
+			Days: aws.Int64(days),
+			GlacierJobParameters: &s3.GlacierJobParameters{
+				Tier: aws.String(tierStr),
+			},
+		},
+	}
+
+	// objects in the intelligent tiering archive tiers are restored back into the frequent access tier
+	// permanently so the request must not include a lifetime
+	if len(obj.ArchiveStatus()) != 0 {
+		input.RestoreRequest.Days = nil
+	}
+
+	_, err := impl.svc.RestoreObjectWithContext(ctx, input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			//case s3.ErrCodeObjectAlreadyInActiveTierError:
+			//	log.Printf("ERROR: already restored (%s)", aerr.Error())
+			case "RestoreAlreadyInProgress":
+				return ErrRestoreInProgress
+			case "GlacierExpeditedRetrievalNotAvailable":
+				return ErrExpeditedUnavailable
+			case s3.ErrCodeInvalidObjectState:
+				//log.Printf("ERROR: inappropriate storage class for restore (%s)", aerr.Error())
+				return ErrCannotRestore
+			case s3.ErrCodeNoSuchBucket:
+				//log.Printf("ERROR: bucket does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			case s3.ErrCodeNoSuchKey:
+				//log.Printf("ERROR: key does not exist (%s)", aerr.Error())
+				return ErrNotFound
+			case "NoSuchVersion":
+				return ErrNotFound
+			default:
+				impl.logError(fmt.Sprintf("%s (%s)", aerr.Code(), aerr.Error()))
+			}
+			return aerr
+		} else {
+			// Print the error, cast err to awserr.Error to get the Code and
+			// Message from an error.
+			impl.logError(fmt.Sprintf("%s", err.Error()))
+			return err
+		}
+		//} else {
+		//log.Printf("INFO: %s", result)
+	}
+	return nil
+}
+
+// the attributes of an object we are about to restore, the object must be archived
+func (impl *uvaS3Impl) restoreTarget(ctx context.Context, obj UvaS3Object) (UvaS3Object, error) {
+
+	// use what we already know if we can
+	if obj.IsGlacier() == true && len(obj.StorageClass()) != 0 {
+		return obj, nil
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsGlacier() == false {
+		return nil, ErrCannotRestore
+	}
+	return s, nil
+}
+
+// the name S3 uses for a restore tier, empty if the tier is not valid
+func restoreTierName(tier int) string {
+	switch tier {
+	case RESTORE_EXPEDITED:
+		return "Expedited"
+	case RESTORE_STANDARD:
+		return "Standard"
+	case RESTORE_BULK:
+		return "Bulk"
+	}
+	return ""
+}
+
+// expedited retrievals are not available for objects in DEEP_ARCHIVE or the intelligent tiering archive tiers
+func validRestoreTier(obj UvaS3Object, tier int) bool {
+	if tier == RESTORE_EXPEDITED &&
+		(obj.StorageClass() == STORAGE_CLASS_DEEP_ARCHIVE || len(obj.ArchiveStatus()) != 0) {
 		return false
 	}
 	return true
 }
 
+// restore an archived object using the configured tier and wait for it to become available
+func (impl *uvaS3Impl) autoRestore(ctx context.Context, obj UvaS3Object) error {
+
+	days := impl.config.AutoRestoreDays
+	if days <= 0 {
+		days = 1
+	}
+
+	impl.logInfo(fmt.Sprintf("s3://%s/%s is archived, restoring it before download", obj.BucketName(), obj.KeyName()))
+
+	err := impl.RestoreObjectWithContext(ctx, obj, impl.config.AutoRestoreTier, days)
+
+	// the tier is not available for this storage class (expedited for deep archive) so use a standard restore
+	if err == ErrTierNotSupported && impl.config.AutoRestoreTier != RESTORE_STANDARD {
+		impl.logWarn(fmt.Sprintf("restore tier not supported for s3://%s/%s, using standard", obj.BucketName(), obj.KeyName()))
+		err = impl.RestoreObjectWithContext(ctx, obj, RESTORE_STANDARD, days)
+	}
+
+	if err != nil && err != ErrRestoreInProgress {
+		return err
+	}
+
+	_, err = impl.WaitForRestore(ctx, obj, impl.config.AutoRestorePoll)
+	return err
+}
+
+// given the versions of a single key (newest first) return the delete markers that hide the most recent
+// object version and the time the object was deleted (the oldest of those markers). found is false if the
+// key is not deleted or there is no object version to recover
+func undeleteMarkers(versions []UvaS3Object) (markers []UvaS3Object, deleted time.Time, found bool) {
+
+	for i, v := range versions {
+		if v.IsDeleteMarker() == false {
+			if i == 0 {
+				return nil, time.Time{}, false
+			}
+			return versions[:i], versions[i-1].LastModified(), true
+		}
+	}
+	return nil, time.Time{}, false
+}
+
+// remove the supplied delete markers and return the object that becomes current
+func (impl *uvaS3Impl) removeDeleteMarkers(ctx context.Context, bucket string, key string, markers []UvaS3Object) (UvaS3Object, error) {
+
+	for _, m := range markers {
+		err := impl.DeleteObjectWithContext(ctx, NewUvaS3ObjectVersion(bucket, key, m.VersionId()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return impl.StatObjectWithContext(ctx, NewUvaS3Object(bucket, key))
+}
+
+// the version id request parameter, nil when no specific version is requested
+func versionId(o UvaS3Object) *string {
+	if len(o.VersionId()) == 0 {
+		return nil
+	}
+	return aws.String(o.VersionId())
+}
+
+// objects in the GLACIER and DEEP_ARCHIVE storage classes must be restored before they can be read,
+// GLACIER_IR objects are available immediately
+func isGlacierStorageClass(storageClass *string) bool {
+	switch aws.StringValue(storageClass) {
+	case string(STORAGE_CLASS_GLACIER), string(STORAGE_CLASS_DEEP_ARCHIVE):
+		return true
+	}
+	return false
+}
+
+// create an object from a bucket listing entry
+func newUvaS3ObjectFromListing(bucket string, entry *s3.Object) uvaS3ObjectImpl {
+
+	o := uvaS3ObjectImpl{bucket: bucket, key: aws.StringValue(entry.Key)}
+	o.isGlacier = isGlacierStorageClass(entry.StorageClass)
+	o.storageClass = storageClass(entry.StorageClass)
+	if entry.RestoreStatus != nil {
+		o.isRestoring = aws.BoolValue(entry.RestoreStatus.IsRestoreInProgress)
+		o.isRestored = o.isRestoring == false && entry.RestoreStatus.RestoreExpiryDate != nil
+		o.restoreExpiry = aws.TimeValue(entry.RestoreStatus.RestoreExpiryDate)
+	}
+	o.size = aws.Int64Value(entry.Size)
+	o.lastModified = aws.TimeValue(entry.LastModified)
+	o.etag = unquoteETag(entry.ETag)
+	return o
+}
+
+// the input for a download of the object, which must still have the attributes we validate the download against
+func getObjectInput(obj UvaS3Object, attrs UvaS3Object) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(obj.BucketName()),
+		Key:       aws.String(obj.KeyName()),
+		VersionId: versionId(obj),
+	}
+	if len(attrs.ETag()) != 0 {
+		input.IfMatch = aws.String(fmt.Sprintf("\"%s\"", attrs.ETag()))
+	}
+	return input
+}
+
+// the HTTP range header for the supplied offset and length (see GetRange), and whether they are valid
+func rangeHeader(offset int64, length int64) (string, bool) {
+	switch {
+	case length < 0:
+		return "", false
+	case offset < 0 && length != 0:
+		return "", false
+	case offset < 0:
+		return fmt.Sprintf("bytes=%d", offset), true
+	case length == 0:
+		return fmt.Sprintf("bytes=%d-", offset), true
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1), true
+}
+
+// verify the entity tag S3 gave an upload against the one we computed, objects encrypted using KMS have entity
+// tags that are not derived from the content so they cannot be verified
+func (impl *uvaS3Impl) verifyUploadETag(ctx context.Context, obj UvaS3Object, result *s3manager.UploadOutput, expected string) error {
+
+	actual := unquoteETag(result.ETag)
+	if actual == expected {
+		return nil
+	}
+
+	s, err := impl.StatObjectWithContext(ctx, NewUvaS3Object(obj.BucketName(), obj.KeyName()))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(s.ServerSideEncryption(), "aws:kms") == true {
+		return nil
+	}
+	if s.ETag() != actual {
+		// someone has replaced the object since our upload so we cannot tell
+		impl.logWarn(fmt.Sprintf("s3://%s/%s replaced during upload verification", obj.BucketName(), obj.KeyName()))
+		return nil
+	}
+
+	impl.logError(fmt.Sprintf("upload of s3://%s/%s failed verification. expected etag %s, got %s", obj.BucketName(), obj.KeyName(), expected, actual))
+	return ErrUploadVerifyFailed
+}
+
+// validate the downloaded content against the checksums and entity tag of the object. Objects encrypted using
+// KMS have entity tags that are not derived from the content. The entity tag and checksums of a multipart object
+// depend on the part sizes which we only know for certain by asking for each part, so we assume they are all the
+// same size as the first and only report a mismatch once we have confirmed that they are
+func (impl *uvaS3Impl) validateContent(ctx context.Context, obj UvaS3Object, attrs UvaS3Object, content io.ReadSeeker) error {
+
+	// full object checksums do not depend on the parts
+	err := validateChecksums(attrs, content)
+	if err != nil {
+		return err
+	}
+
+	etag := attrs.ETag()
+	if strings.HasPrefix(attrs.ServerSideEncryption(), "aws:kms") == true {
+		etag = ""
+	}
+	composite := make(map[UvaS3ChecksumAlgorithm]string)
+	for algorithm, checksum := range attrs.Checksums() {
+		if len(checksum) != 0 && isFullObjectChecksum(checksum) == false && validChecksumAlgorithm(algorithm) == true {
+			composite[algorithm] = checksum
+		}
+	}
+	if len(etag) == 0 && len(composite) == 0 {
+		return nil
+	}
+
+	partSize := attrs.Size() + 1
+	parts := int64(1)
+	if isMultipartETag(etag) == true || len(composite) != 0 {
+		// the first part tells us the part size
+		partSize, parts, err = impl.partSize(ctx, obj, 1)
+		if err != nil {
+			impl.logWarn(fmt.Sprintf("cannot determine the part size of s3://%s/%s (%s)", obj.BucketName(), obj.KeyName(), err.Error()))
+			return nil
+		}
+		if partSize <= 0 || (attrs.Size()+partSize-1)/partSize != parts {
+			// the parts are not all the same size
+			return nil
+		}
+	}
+
+	mismatch := false
+	if len(etag) != 0 {
+		_, err = content.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		hasher := newCountingReader(content, partSize)
+		_, err = io.Copy(io.Discard, hasher)
+		if err != nil {
+			return err
+		}
+		mismatch = hasher.etag(isMultipartETag(etag)) != etag
+	}
+
+	for algorithm, expected := range composite {
+		if mismatch == true {
+			break
+		}
+		_, err = content.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		actual, err := compositeChecksumOf(algorithm, content, partSize)
+		if err != nil {
+			return err
+		}
+		mismatch = actual != expected
+	}
+
+	if mismatch == false {
+		return nil
+	}
+
+	// confirm the remaining parts are the size we assumed before reporting the mismatch
+	for p := int64(2); p <= parts; p++ {
+		expected := partSize
+		if p == parts {
+			expected = attrs.Size() - (parts-1)*partSize
+		}
+		actual, _, err := impl.partSize(ctx, obj, p)
+		if err != nil || actual != expected {
+			impl.logWarn(fmt.Sprintf("cannot validate s3://%s/%s, the parts are not all the same size", obj.BucketName(), obj.KeyName()))
+			return nil
+		}
+	}
+	return ErrChecksumMismatch
+}
+
+// the size of a part of a multipart object and the number of parts
+func (impl *uvaS3Impl) partSize(ctx context.Context, obj UvaS3Object, part int64) (int64, int64, error) {
+	result, err := impl.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(obj.BucketName()),
+		Key:        aws.String(obj.KeyName()),
+		VersionId:  versionId(obj),
+		PartNumber: aws.Int64(part),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return aws.Int64Value(result.ContentLength), aws.Int64Value(result.PartsCount), nil
+}
+
+// a reader that counts the bytes read through it and computes the entity tag S3 gives them when they are
+// uploaded in parts of the supplied size
+type countingReader struct {
+	reader    io.Reader
+	count     int64
+	partSize  int64
+	part      hash.Hash // the MD5 of the current part
+	partBytes int64     // the size of the current part
+	sums      []byte    // the MD5s of the completed parts
+}
+
+func newCountingReader(reader io.Reader, partSize int64) *countingReader {
+	return &countingReader{reader: reader, partSize: partSize, part: md5.New()}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+
+	// hash the bytes read, splitting them at the part boundaries
+	b := p[:n]
+	for len(b) > 0 {
+		sz := c.partSize - c.partBytes
+		if int64(len(b)) < sz {
+			sz = int64(len(b))
+		}
+		c.part.Write(b[:sz])
+		c.partBytes += sz
+		b = b[sz:]
+		if c.partBytes == c.partSize {
+			c.sums = c.part.Sum(c.sums)
+			c.part.Reset()
+			c.partBytes = 0
+		}
+	}
+	return n, err
+}
+
+// the MD5 of everything read, valid when it all fits in a single part
+func (c *countingReader) digest() []byte {
+	if len(c.sums) != 0 {
+		return c.sums[:md5.Size]
+	}
+	return c.part.Sum(nil)
+}
+
+// the entity tag of a single part or a multipart upload of everything read
+func (c *countingReader) etag(multipart bool) string {
+	if multipart == false {
+		return hex.EncodeToString(c.digest())
+	}
+
+	sums := c.sums
+	if c.partBytes != 0 {
+		sums = c.part.Sum(sums)
+	}
+	h := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(h[:]), len(sums)/md5.Size)
+}
+
+// the part size the uploader uses for an upload of the supplied size, it is increased if necessary to stay
+// within the part count limit (see s3manager uploader.initSize)
+func uploaderPartSize(uploader s3manager.Uploader, size int64, options ...func(*s3manager.Uploader)) int64 {
+
+	for _, option := range options {
+		option(&uploader)
+	}
+
+	partSize := uploader.PartSize
+	if partSize == 0 {
+		partSize = s3manager.DefaultUploadPartSize
+	}
+	maxParts := int64(uploader.MaxUploadParts)
+	if maxParts == 0 {
+		maxParts = int64(s3manager.MaxUploadParts)
+	}
+	if size/partSize >= maxParts {
+		partSize = (size / maxParts) + 1
+	}
+	return partSize
+}
+
 //
 // uvaS3ObjectImpl implementation methods
 //
@@ -494,6 +2759,18 @@ func (impl uvaS3ObjectImpl) KeyName() string {
 	return impl.key
 }
 
+func (impl uvaS3ObjectImpl) VersionId() string {
+	return impl.versionId
+}
+
+func (impl uvaS3ObjectImpl) IsLatest() bool {
+	return impl.isLatest
+}
+
+func (impl uvaS3ObjectImpl) IsDeleteMarker() bool {
+	return impl.isDelete
+}
+
 func (impl uvaS3ObjectImpl) IsGlacier() bool {
 	return impl.isGlacier
 }
@@ -506,6 +2783,18 @@ func (impl uvaS3ObjectImpl) IsRestored() bool {
 	return impl.isRestored
 }
 
+func (impl uvaS3ObjectImpl) ArchiveStatus() string {
+	return impl.archiveStatus
+}
+
+func (impl uvaS3ObjectImpl) Checksums() map[UvaS3ChecksumAlgorithm]string {
+	return impl.checksums
+}
+
+func (impl uvaS3ObjectImpl) RestoreExpiry() time.Time {
+	return impl.restoreExpiry
+}
+
 func (impl uvaS3ObjectImpl) Size() int64 {
 	return impl.size
 }
@@ -514,6 +2803,42 @@ func (impl uvaS3ObjectImpl) LastModified() time.Time {
 	return impl.lastModified
 }
 
+func (impl uvaS3ObjectImpl) ETag() string {
+	return impl.etag
+}
+
+func (impl uvaS3ObjectImpl) StorageClass() UvaS3StorageClass {
+	return impl.storageClass
+}
+
+func (impl uvaS3ObjectImpl) ContentType() string {
+	return impl.contentType
+}
+
+func (impl uvaS3ObjectImpl) Metadata() map[string]string {
+	return impl.metadata
+}
+
+func (impl uvaS3ObjectImpl) ServerSideEncryption() string {
+	return impl.sse
+}
+
+func (impl uvaS3ObjectImpl) SSEKMSKeyId() string {
+	return impl.sseKmsKeyId
+}
+
+func (impl uvaS3ObjectImpl) ReplicationStatus() string {
+	return impl.replicationStatus
+}
+
+func (impl uvaS3ObjectImpl) ExpiryDate() time.Time {
+	return impl.expiryDate
+}
+
+func (impl uvaS3ObjectImpl) ExpiryRule() string {
+	return impl.expiryRule
+}
+
 //
 // end of file
 //
@@ -0,0 +1,95 @@
+package uva_s3
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// a file of JSON records (one per line) that we append to as work progresses so the work can be continued
+// after an interruption. The caller is responsible for any locking
+type jsonLinesFile struct {
+	file *os.File // open for append
+}
+
+// create (or truncate) the named file and write the supplied header as the first record
+func createJSONLines(name string, header interface{}) (*jsonLinesFile, error) {
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &jsonLinesFile{file: file}
+	err = j.append(header)
+	if err != nil {
+		j.close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// open the named file for append, creating it if necessary
+func openJSONLines(name string) (*jsonLinesFile, error) {
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesFile{file: file}, nil
+}
+
+// read the named file, decoding the first record into header (unless header is nil) and passing each of the
+// remaining records to fn. Records that fn cannot decode are skipped, they are probably a partial write when
+// we were interrupted. Returns the number of records skipped and an error satisfying os.IsNotExist when there
+// is no file
+func readJSONLines(name string, header interface{}, fn func(b []byte) error) (int, error) {
+
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if header != nil {
+		if scanner.Scan() == false {
+			if scanner.Err() != nil {
+				return 0, scanner.Err()
+			}
+			return 0, fmt.Errorf("missing header")
+		}
+		err = json.Unmarshal(scanner.Bytes(), header)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	skipped := 0
+	for scanner.Scan() {
+		if fn(scanner.Bytes()) != nil {
+			skipped++
+		}
+	}
+	return skipped, scanner.Err()
+}
+
+// append a record
+func (j *jsonLinesFile) append(record interface{}) error {
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(b, '\n'))
+	return err
+}
+
+func (j *jsonLinesFile) close() error {
+	return j.file.Close()
+}
+
+//
+// end of file
+//
@@ -0,0 +1,267 @@
+package uva_s3
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// the default object reader options
+const defaultReaderBlockSize = int64(1024 * 1024)
+const defaultReaderCacheBlocks = 16
+const defaultReaderReadAhead = 2
+
+// gets the supplied range of the object
+type rangeGetter func(context.Context, string) (io.ReadCloser, error)
+
+// this is our object reader implementation
+type uvaS3ObjectReaderImpl struct {
+	size    int64
+	options UvaS3ReaderOptions
+	get     rangeGetter
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	lock   sync.Mutex             // protects everything below
+	offset int64                  // the current offset for Read and Seek
+	closed bool                   // has the reader been closed
+	blocks map[int64]*readerBlock // cached and in flight blocks by block number
+	lru    *list.List             // the cached block numbers, most recently used at the front
+	last   int64                  // the most recently read block, used to detect sequential reads
+}
+
+// a cached block, done is closed once the fetch completes
+type readerBlock struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	element *list.Element
+}
+
+// factory for our object reader
+func newUvaS3ObjectReader(ctx context.Context, size int64, options UvaS3ReaderOptions, get rangeGetter) (UvaS3ObjectReader, error) {
+
+	// validate inbound parameters
+	if size < 0 || options.BlockSize < 0 || options.CacheBlocks < 0 || get == nil {
+		return nil, ErrBadParameter
+	}
+
+	if options.BlockSize == 0 {
+		options.BlockSize = defaultReaderBlockSize
+	}
+	if options.CacheBlocks == 0 {
+		options.CacheBlocks = defaultReaderCacheBlocks
+	}
+	if options.ReadAhead == 0 {
+		options.ReadAhead = defaultReaderReadAhead
+	}
+	if options.ReadAhead < 0 {
+		options.ReadAhead = 0
+	}
+
+	// the cache must hold the current block and the blocks read ahead of it
+	if options.CacheBlocks <= options.ReadAhead {
+		return nil, ErrBadParameter
+	}
+
+	var impl uvaS3ObjectReaderImpl
+	impl.size = size
+	impl.options = options
+	impl.get = get
+	impl.ctx, impl.cancel = context.WithCancel(ctx)
+	impl.blocks = make(map[int64]*readerBlock)
+	impl.lru = list.New()
+	impl.last = -1
+
+	return &impl, nil
+}
+
+func (impl *uvaS3ObjectReaderImpl) Size() int64 {
+	return impl.size
+}
+
+func (impl *uvaS3ObjectReaderImpl) ReadAt(p []byte, off int64) (int, error) {
+
+	if off < 0 {
+		return 0, ErrBadParameter
+	}
+	if off >= impl.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < impl.size {
+		blk := off / impl.options.BlockSize
+		data, err := impl.block(blk)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], data[off-blk*impl.options.BlockSize:])
+		n += c
+		off += int64(c)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (impl *uvaS3ObjectReaderImpl) Read(p []byte) (int, error) {
+
+	impl.lock.Lock()
+	if impl.closed == true {
+		impl.lock.Unlock()
+		return 0, ErrReaderClosed
+	}
+	off := impl.offset
+	impl.lock.Unlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := impl.ReadAt(p, off)
+
+	impl.lock.Lock()
+	impl.offset = off + int64(n)
+	impl.lock.Unlock()
+
+	return n, err
+}
+
+func (impl *uvaS3ObjectReaderImpl) Seek(offset int64, whence int) (int64, error) {
+
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	if impl.closed == true {
+		return 0, ErrReaderClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += impl.offset
+	case io.SeekEnd:
+		offset += impl.size
+	default:
+		return 0, ErrBadParameter
+	}
+
+	if offset < 0 {
+		return 0, ErrBadParameter
+	}
+
+	impl.offset = offset
+	return offset, nil
+}
+
+func (impl *uvaS3ObjectReaderImpl) Close() error {
+
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	if impl.closed == true {
+		return nil
+	}
+
+	// abandon any fetches in flight and release the cache
+	impl.closed = true
+	impl.cancel()
+	impl.blocks = make(map[int64]*readerBlock)
+	impl.lru.Init()
+	return nil
+}
+
+//
+// helpers
+//
+
+// get the contents of a block, fetching it (and the blocks that follow a sequential read) if necessary
+func (impl *uvaS3ObjectReaderImpl) block(blk int64) ([]byte, error) {
+
+	impl.lock.Lock()
+	if impl.closed == true {
+		impl.lock.Unlock()
+		return nil, ErrReaderClosed
+	}
+
+	b := impl.cached(blk)
+
+	// read ahead when the reads are sequential
+	if blk == impl.last+1 {
+		blocks := (impl.size + impl.options.BlockSize - 1) / impl.options.BlockSize
+		for ahead := blk + 1; ahead <= blk+int64(impl.options.ReadAhead) && ahead < blocks; ahead++ {
+			impl.cached(ahead)
+		}
+	}
+	impl.last = blk
+	impl.lock.Unlock()
+
+	<-b.done
+	return b.data, b.err
+}
+
+// get a block from the cache, starting the fetch if it is not there. Called with the lock held
+func (impl *uvaS3ObjectReaderImpl) cached(blk int64) *readerBlock {
+
+	b, ok := impl.blocks[blk]
+	if ok == true {
+		impl.lru.MoveToFront(b.element)
+		return b
+	}
+
+	b = &readerBlock{done: make(chan struct{})}
+	b.element = impl.lru.PushFront(blk)
+	impl.blocks[blk] = b
+	go impl.fetch(blk, b)
+
+	// evict the least recently used blocks, anyone waiting on them still gets the result
+	for impl.lru.Len() > impl.options.CacheBlocks {
+		e := impl.lru.Back()
+		impl.lru.Remove(e)
+		delete(impl.blocks, e.Value.(int64))
+	}
+	return b
+}
+
+// fetch the contents of a block
+func (impl *uvaS3ObjectReaderImpl) fetch(blk int64, b *readerBlock) {
+
+	defer close(b.done)
+
+	offset := blk * impl.options.BlockSize
+	length := impl.options.BlockSize
+	if offset+length > impl.size {
+		length = impl.size - offset
+	}
+
+	byteRange, _ := rangeHeader(offset, length)
+	reader, err := impl.get(impl.ctx, byteRange)
+	if err == nil {
+		data := make([]byte, length)
+		_, err = io.ReadFull(reader, data)
+		reader.Close()
+		if err == nil {
+			b.data = data
+			return
+		}
+		err = fmt.Errorf("short read of %s (%s)", byteRange, err.Error())
+	}
+
+	// failed blocks are not cached so they are fetched again next time
+	b.err = err
+	impl.lock.Lock()
+	if impl.blocks[blk] == b {
+		impl.lru.Remove(b.element)
+		delete(impl.blocks, blk)
+	}
+	impl.lock.Unlock()
+}
+
+//
+// end of file
+//
@@ -0,0 +1,25 @@
+package uva_s3
+
+import (
+	"io"
+)
+
+// UvaS3ObjectReader random access to the contents of an object using ranged gets. Blocks of the object are
+// cached in memory and sequential reads fetch the following blocks ahead of time
+type UvaS3ObjectReader interface {
+	io.ReaderAt
+	io.ReadSeeker
+	io.Closer
+	Size() int64 // the object size
+}
+
+// UvaS3ReaderOptions our object reader options, zero values use the defaults
+type UvaS3ReaderOptions struct {
+	BlockSize   int64 // the size of each ranged get (default 1MB)
+	CacheBlocks int   // the number of blocks held in the cache (default 16)
+	ReadAhead   int   // the number of blocks fetched ahead of sequential reads (default 2, negative disables)
+}
+
+//
+// end of file
+//
@@ -0,0 +1,412 @@
+package uva_s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// the default number of concurrent restore requests or status checks
+const defaultRestoreConcurrency = 10
+
+// the restore states recorded in the journal
+const (
+	restoreStateRequested  = "requested"
+	restoreStateInProgress = "in-progress"
+	restoreStateRestored   = "restored"
+	restoreStateFailed     = "failed"
+)
+
+// this is our restore manager implementation
+type uvaS3RestoreManagerImpl struct {
+	config UvaS3RestoreConfig
+	s3     UvaS3
+	lock   sync.Mutex                      // protects the state and the journal
+	state  map[string]*restoreJournalEntry // the current state of each object
+	order  []string                        // the objects in the order we first saw them
+}
+
+// a journal entry, the journal is a file of JSON entries (one per line) and the last entry for an object wins
+type restoreJournalEntry struct {
+	Bucket  string    `json:"bucket"`
+	Key     string    `json:"key"`
+	Version string    `json:"version,omitempty"`
+	State   string    `json:"state"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// factory for our restore manager
+func newUvaS3RestoreManager(s3 UvaS3, config UvaS3RestoreConfig) (UvaS3RestoreManager, error) {
+
+	// validate inbound parameters
+	if s3 == nil || len(config.Journal) == 0 || config.Days <= 0 || config.Concurrency < 0 ||
+		(config.Tier != RESTORE_EXPEDITED && config.Tier != RESTORE_STANDARD && config.Tier != RESTORE_BULK) {
+		return nil, ErrBadParameter
+	}
+
+	if config.Concurrency == 0 {
+		config.Concurrency = defaultRestoreConcurrency
+	}
+
+	var impl uvaS3RestoreManagerImpl
+	impl.config = config
+	impl.s3 = s3
+	impl.state = make(map[string]*restoreJournalEntry)
+	impl.order = make([]string, 0)
+
+	err := impl.loadJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	return &impl, nil
+}
+
+func (impl *uvaS3RestoreManagerImpl) RequestObjects(ctx context.Context, objs []UvaS3Object) error {
+
+	// validate inbound parameters
+	if ctx == nil {
+		return ErrBadParameter
+	}
+	for _, o := range objs {
+		if o == nil || len(o.BucketName()) == 0 || len(o.KeyName()) == 0 {
+			return ErrBadParameter
+		}
+	}
+
+	// anything we have already requested (or that is already restored) does not need requesting again
+	pending := make([]UvaS3Object, 0, len(objs))
+	impl.lock.Lock()
+	for _, o := range objs {
+		e, found := impl.state[restoreJournalKey(o)]
+		if found == false || e.State == restoreStateFailed {
+			pending = append(pending, o)
+		}
+	}
+	impl.lock.Unlock()
+
+	impl.logInfo(fmt.Sprintf("requesting restore of %d objects (%d already requested)", len(pending), len(objs)-len(pending)))
+
+	err := impl.forEach(ctx, pending, impl.requestRestore)
+	impl.logProgress()
+	return err
+}
+
+func (impl *uvaS3RestoreManagerImpl) RequestPrefix(ctx context.Context, bucket string, prefix string) error {
+
+	// validate inbound parameters
+	if ctx == nil || len(bucket) == 0 {
+		return ErrBadParameter
+	}
+
+	objs := make([]UvaS3Object, 0)
+	var journalErr error
+	_, err := impl.s3.ListObjectsWithContext(ctx, bucket, prefix, "", func(o UvaS3Object) bool {
+
+		// objects that are not archived do not need restoring. The listing does not tell us if an intelligent
+		// tiering object is in an archive tier so we let the restore request work that out
+		if o.IsGlacier() == false && o.StorageClass() != STORAGE_CLASS_INTELLIGENT_TIERING {
+			return true
+		}
+
+		if o.IsRestored() == true {
+			impl.lock.Lock()
+			_, found := impl.state[restoreJournalKey(o)]
+			impl.lock.Unlock()
+			if found == false {
+				journalErr = impl.setState(o, restoreStateRestored, nil)
+			}
+		} else {
+			objs = append(objs, o)
+		}
+		return journalErr == nil && ctx.Err() == nil
+	})
+
+	if err != nil {
+		return err
+	}
+	if journalErr != nil {
+		return journalErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return impl.RequestObjects(ctx, objs)
+}
+
+func (impl *uvaS3RestoreManagerImpl) Wait(ctx context.Context) error {
+
+	// validate inbound parameters
+	if ctx == nil {
+		return ErrBadParameter
+	}
+
+	policy := pollPolicyDefaults(impl.config.PollPolicy)
+	if policy.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	interval := policy.InitialInterval
+	for {
+		outstanding := impl.outstanding()
+		if len(outstanding) == 0 {
+			impl.logProgress()
+			return nil
+		}
+
+		err := impl.forEach(ctx, outstanding, impl.checkRestore)
+		if err != nil {
+			return restoreWaitError(ctx, err)
+		}
+
+		impl.logProgress()
+		if len(impl.outstanding()) == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return restoreWaitError(ctx, ctx.Err())
+		case <-timer.C:
+		}
+
+		interval = nextPollInterval(policy, interval)
+	}
+}
+
+func (impl *uvaS3RestoreManagerImpl) Progress() UvaS3RestoreProgress {
+
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	var progress UvaS3RestoreProgress
+	for _, e := range impl.state {
+		progress.Total++
+		switch e.State {
+		case restoreStateRequested:
+			progress.Requested++
+		case restoreStateInProgress:
+			progress.InProgress++
+		case restoreStateRestored:
+			progress.Restored++
+		case restoreStateFailed:
+			progress.Failed++
+		}
+	}
+	return progress
+}
+
+//
+// helpers
+//
+
+// issue the restore request for an object and record the outcome
+func (impl *uvaS3RestoreManagerImpl) requestRestore(ctx context.Context, o UvaS3Object) error {
+
+	err := impl.s3.RestoreObjectWithContext(ctx, o, impl.config.Tier, impl.config.Days)
+
+	// the tier is not available for this storage class (expedited for deep archive) so use a standard restore
+	if err == ErrTierNotSupported && impl.config.Tier != RESTORE_STANDARD {
+		impl.logWarn(fmt.Sprintf("restore tier not supported for s3://%s/%s, using standard", o.BucketName(), o.KeyName()))
+		err = impl.s3.RestoreObjectWithContext(ctx, o, RESTORE_STANDARD, impl.config.Days)
+	}
+
+	if err == nil {
+		return impl.setState(o, restoreStateRequested, nil)
+	}
+
+	// the object is not archived so it is already available, S3 also refuses restores of archived objects
+	// it cannot restore so we check which it is
+	if err == ErrCannotRestore {
+		s, serr := impl.s3.StatObjectWithContext(ctx, o)
+		if serr == nil && s.IsGlacier() == false {
+			return impl.setState(o, restoreStateRestored, nil)
+		}
+	}
+
+	// someone else has already requested a restore
+	if err == ErrRestoreInProgress {
+		return impl.setState(o, restoreStateInProgress, nil)
+	}
+
+	impl.logError(fmt.Sprintf("restore of s3://%s/%s failed (%s)", o.BucketName(), o.KeyName(), err.Error()))
+	return impl.setState(o, restoreStateFailed, err)
+}
+
+// check the restore status of an object and record it
+func (impl *uvaS3RestoreManagerImpl) checkRestore(ctx context.Context, o UvaS3Object) error {
+
+	s, err := impl.s3.StatObjectWithContext(ctx, o)
+	if err != nil {
+		if err == ErrNotFound {
+			return impl.setState(o, restoreStateFailed, err)
+		}
+		// assume the error is transient and check again next time
+		impl.logWarn(fmt.Sprintf("checking s3://%s/%s (%s)", o.BucketName(), o.KeyName(), err.Error()))
+		return nil
+	}
+
+	switch {
+	case s.IsGlacier() == false || s.IsRestored() == true:
+		return impl.setState(o, restoreStateRestored, nil)
+	case s.IsRestoring() == true:
+		return impl.setState(o, restoreStateInProgress, nil)
+	}
+
+	// the restore is neither in progress nor complete, it has probably already expired
+	return impl.setState(o, restoreStateFailed, ErrNotRestoring)
+}
+
+// the objects whose restores have not yet completed
+func (impl *uvaS3RestoreManagerImpl) outstanding() []UvaS3Object {
+
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	objs := make([]UvaS3Object, 0)
+	for _, k := range impl.order {
+		e := impl.state[k]
+		if e.State == restoreStateRequested || e.State == restoreStateInProgress {
+			objs = append(objs, NewUvaS3ObjectVersion(e.Bucket, e.Key, e.Version))
+		}
+	}
+	return objs
+}
+
+// apply the supplied function to each object using our configured concurrency. Stops early and returns
+// the first error or the context error
+func (impl *uvaS3RestoreManagerImpl) forEach(ctx context.Context, objs []UvaS3Object, fn func(context.Context, UvaS3Object) error) error {
+	return forEachConcurrently(ctx, len(objs), impl.config.Concurrency, func(ctx context.Context, ix int) error {
+		return fn(ctx, objs[ix])
+	})
+}
+
+// record the state of an object in memory and in the journal
+func (impl *uvaS3RestoreManagerImpl) setState(o UvaS3Object, state string, err error) error {
+
+	e := restoreJournalEntry{
+		Bucket:  o.BucketName(),
+		Key:     o.KeyName(),
+		Version: o.VersionId(),
+		State:   state,
+		Time:    time.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	k := restoreJournalKey(o)
+	previous, found := impl.state[k]
+	if found == true && previous.State == state {
+		// nothing has changed so no need to journal it
+		return nil
+	}
+	if found == false {
+		impl.order = append(impl.order, k)
+	}
+	impl.state[k] = &e
+
+	return impl.appendJournal(e)
+}
+
+// append an entry to the journal, the caller holds the lock
+func (impl *uvaS3RestoreManagerImpl) appendJournal(e restoreJournalEntry) error {
+
+	journal, err := openJSONLines(impl.config.Journal)
+	if err != nil {
+		return err
+	}
+
+	err = journal.append(e)
+	if err != nil {
+		journal.close()
+		return err
+	}
+	return journal.close()
+}
+
+// load the state from an existing journal
+func (impl *uvaS3RestoreManagerImpl) loadJournal() error {
+
+	skipped, err := readJSONLines(impl.config.Journal, nil, func(b []byte) error {
+		var e restoreJournalEntry
+		err := json.Unmarshal(b, &e)
+		if err != nil {
+			return err
+		}
+		k := restoreJournalKey(NewUvaS3ObjectVersion(e.Bucket, e.Key, e.Version))
+		if _, found := impl.state[k]; found == false {
+			impl.order = append(impl.order, k)
+		}
+		impl.state[k] = &e
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if skipped != 0 {
+		impl.logWarn(fmt.Sprintf("ignoring %d bad journal entries in %s", skipped, impl.config.Journal))
+	}
+
+	p := impl.Progress()
+	impl.logInfo(fmt.Sprintf("loaded %d objects from %s", p.Total, impl.config.Journal))
+	return nil
+}
+
+func (impl *uvaS3RestoreManagerImpl) logProgress() {
+	p := impl.Progress()
+	impl.logInfo(fmt.Sprintf("restore progress: %d objects, %d requested, %d in progress, %d restored, %d failed",
+		p.Total, p.Requested, p.InProgress, p.Restored, p.Failed))
+}
+
+func (impl *uvaS3RestoreManagerImpl) logInfo(message string) {
+	if impl.config.Logging == true {
+		log.Printf("INFO: %s", message)
+	}
+}
+
+func (impl *uvaS3RestoreManagerImpl) logWarn(message string) {
+	if impl.config.Logging == true {
+		log.Printf("WARNING: %s", message)
+	}
+}
+
+func (impl *uvaS3RestoreManagerImpl) logError(message string) {
+	if impl.config.Logging == true {
+		log.Printf("ERROR: %s", message)
+	}
+}
+
+// the key we use to identify an object in the journal
+func restoreJournalKey(o UvaS3Object) string {
+	return fmt.Sprintf("%s/%s?%s", o.BucketName(), o.KeyName(), o.VersionId())
+}
+
+// a deadline while waiting is reported as a restore timeout
+func restoreWaitError(ctx context.Context, err error) error {
+	if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+		return ErrRestoreTimeout
+	}
+	return err
+}
+
+//
+// end of file
+//
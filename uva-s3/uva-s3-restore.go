@@ -0,0 +1,42 @@
+package uva_s3
+
+import (
+	"context"
+)
+
+// UvaS3RestoreManager manages the bulk restore of objects from glacier. The state of each object is recorded
+// in a journal file so an interrupted restore can be resumed by creating a new manager with the same journal
+type UvaS3RestoreManager interface {
+	RequestObjects(context.Context, []UvaS3Object) error // issue restores for the supplied objects
+	RequestPrefix(context.Context, string, string) error // issue restores for the archived objects below a prefix
+	Wait(context.Context) error                          // wait for the outstanding restores to complete
+	Progress() UvaS3RestoreProgress                      // the aggregate restore progress
+}
+
+// UvaS3RestoreConfig our restore manager configuration structure
+type UvaS3RestoreConfig struct {
+	Journal     string          // the journal file, created if it does not exist
+	Tier        int             // the restore tier (RESTORE_EXPEDITED, RESTORE_STANDARD or RESTORE_BULK), standard when not supported
+	Days        int64           // how many days the restored copies remain available
+	Concurrency int             // how many restore requests or status checks are issued concurrently (default 10)
+	PollPolicy  UvaS3PollPolicy // how we poll for restore completion
+	Logging     bool            // do we log
+}
+
+// UvaS3RestoreProgress the aggregate state of the objects known to a restore manager
+type UvaS3RestoreProgress struct {
+	Total      int // the number of objects
+	Requested  int // the restore has been requested
+	InProgress int // the restore is known to be in progress
+	Restored   int // the object is restored (or did not need restoring)
+	Failed     int // the restore request failed or the restore did not complete
+}
+
+// NewUvaS3RestoreManager factory for our restore manager
+func NewUvaS3RestoreManager(s3 UvaS3, config UvaS3RestoreConfig) (UvaS3RestoreManager, error) {
+	return newUvaS3RestoreManager(s3, config)
+}
+
+//
+// end of file
+//
@@ -0,0 +1,396 @@
+package uva_s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// the minimum part size and the concurrency for resumable uploads
+const uploadPartSize = int64(64 * 1024 * 1024)
+const uploadConcurrency = 4
+
+// the S3 limit on the number of parts in a multipart upload
+const maxUploadParts = int64(10000)
+
+// the suffix of the state file kept beside the source of a resumable upload
+const uploadStateSuffix = ".uvas3-upload"
+
+// the first entry of an upload state file identifies the multipart upload and the source file. The remaining
+// entries (one per line) record the parts that have been uploaded
+type uploadStateHeader struct {
+	Bucket   string                 `json:"bucket"`
+	Key      string                 `json:"key"`
+	UploadId string                 `json:"upload_id"`
+	Size     int64                  `json:"size"`
+	ModTime  time.Time              `json:"mod_time"`
+	PartSize int64                  `json:"part_size"`
+	Checksum UvaS3ChecksumAlgorithm `json:"checksum,omitempty"`
+	Options  string                 `json:"options"` // a digest of the put options, they are applied when the upload is created
+}
+
+type uploadStatePart struct {
+	Part     int64  `json:"part"`
+	ETag     string `json:"etag"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// the state of a resumable upload
+type uploadState struct {
+	header uploadStateHeader
+	parts  map[int64]uploadStatePart // the uploaded parts by part number
+	file   *jsonLinesFile            // the state file (nil when not persisted)
+	lock   sync.Mutex                // protects parts and file
+}
+
+// put a file to the named object using a multipart upload that can be continued after a failure
+func (impl *uvaS3Impl) putFromFileResumable(ctx context.Context, obj UvaS3Object, location string, options UvaS3PutOptions) error {
+	return impl.putFromFileMultipart(ctx, obj, location, options, true)
+}
+
+// put a file to the named object using our own multipart upload. When resumable the upload state is kept beside
+// the file so the upload can be continued after a failure, otherwise a failed upload is aborted
+func (impl *uvaS3Impl) putFromFileMultipart(ctx context.Context, obj UvaS3Object, location string, options UvaS3PutOptions, resumable bool) error {
+
+	// validate inbound parameters
+	if impl.validateS3Obj(obj) == false || len(location) == 0 || validPutOptions(options) == false {
+		return ErrBadParameter
+	}
+
+	s, err := os.Stat(location)
+	if err != nil {
+		// assume the error is file not found... probably reasonable
+		return os.ErrNotExist
+	}
+
+	// small files are uploaded in a single request so there is nothing to resume
+	if s.Size() <= uploadPartSize {
+		return impl.PutFromFileWithOptionsContext(ctx, obj, location, options)
+	}
+
+	source := fmt.Sprintf("s3://%s/%s", obj.BucketName(), obj.KeyName())
+	header := uploadStateHeader{
+		Bucket:   obj.BucketName(),
+		Key:      obj.KeyName(),
+		Size:     s.Size(),
+		ModTime:  s.ModTime().UTC(),
+		PartSize: uploadPartSizeFor(s.Size()),
+		Checksum: options.Checksum,
+		Options:  putOptionsDigest(options),
+	}
+
+	var state *uploadState
+	stateFile := location + uploadStateSuffix
+	if resumable == true {
+		state, err = loadUploadState(stateFile)
+		if err != nil {
+			impl.logWarn(fmt.Sprintf("ignoring upload state %s (%s)", stateFile, err.Error()))
+		}
+	}
+
+	// we can only continue an earlier upload of the same file to the same object
+	var uploaded map[int64]string
+	if state != nil {
+		header.UploadId = state.header.UploadId
+		if state.header == header {
+			uploaded, err = impl.listUploadedParts(ctx, header)
+			if err != nil {
+				state.close()
+				return impl.copyError(err)
+			}
+		}
+		if uploaded == nil {
+			impl.logInfo(fmt.Sprintf("upload of %s to %s cannot be continued, starting again", location, source))
+			// dont leave the parts of the abandoned upload lying around
+			impl.abortUpload(state.header)
+			state.close()
+			state = nil
+		}
+	}
+
+	if state == nil {
+		input := &s3manager.UploadInput{}
+		applyPutOptions(input, options)
+		create := &s3.CreateMultipartUploadInput{}
+		awsutil.Copy(create, input)
+		create.Bucket = aws.String(obj.BucketName())
+		create.Key = aws.String(obj.KeyName())
+		if len(options.Checksum) != 0 {
+			create.ChecksumAlgorithm = aws.String(string(options.Checksum))
+		}
+
+		result, err := impl.svc.CreateMultipartUploadWithContext(ctx, create)
+		if err != nil {
+			return impl.copyError(err)
+		}
+		header.UploadId = aws.StringValue(result.UploadId)
+		if resumable == true {
+			state, err = newUploadState(stateFile, header)
+			if err != nil {
+				impl.abortUpload(header)
+				return err
+			}
+		} else {
+			// the state is only kept in memory
+			state = &uploadState{header: header, parts: make(map[int64]uploadStatePart)}
+		}
+		uploaded = make(map[int64]string)
+	}
+	defer state.close()
+
+	// a part is only complete when S3 has the part we recorded, anything else is uploaded again
+	parts := (header.Size + header.PartSize - 1) / header.PartSize
+	pending := make([]int64, 0)
+	for p := int64(1); p <= parts; p++ {
+		part, found := state.parts[p]
+		if found == false || uploaded[p] != part.ETag {
+			delete(state.parts, p)
+			pending = append(pending, p)
+		}
+	}
+
+	impl.logInfo(fmt.Sprintf("put from %s to %s (%d of %d parts remaining)", location, source, len(pending), parts))
+
+	file, err := os.Open(location)
+	if err != nil {
+		if resumable == false {
+			impl.abortUpload(header)
+		}
+		return err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	err = impl.uploadParts(ctx, file, state, pending)
+	if err != nil {
+		// when resumable we keep the multipart upload and the state so we can continue later
+		if resumable == false {
+			impl.abortUpload(header)
+		}
+		return impl.copyError(err)
+	}
+
+	completed := make([]*s3.CompletedPart, 0, parts)
+	for p := int64(1); p <= parts; p++ {
+		part := &s3.CompletedPart{PartNumber: aws.Int64(p), ETag: aws.String(state.parts[p].ETag)}
+		if len(header.Checksum) != 0 {
+			setCompletedPartChecksum(part, header.Checksum, state.parts[p].Checksum)
+		}
+		completed = append(completed, part)
+	}
+
+	_, err = impl.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(header.Bucket),
+		Key:             aws.String(header.Key),
+		UploadId:        aws.String(header.UploadId),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		if resumable == false {
+			impl.abortUpload(header)
+		}
+		return impl.copyError(err)
+	}
+
+	// the upload is complete so we no longer need the state
+	state.close()
+	if resumable == true {
+		_ = os.Remove(stateFile)
+	}
+
+	duration := time.Since(start)
+	impl.logInfo(fmt.Sprintf("put %s complete in %0.2f seconds (%d bytes)", source, duration.Seconds(), header.Size))
+	return nil
+}
+
+// the parts S3 already has for a multipart upload, returns nil if the upload no longer exists
+func (impl *uvaS3Impl) listUploadedParts(ctx context.Context, header uploadStateHeader) (map[int64]string, error) {
+
+	uploaded := make(map[int64]string)
+	err := impl.svc.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(header.Bucket),
+		Key:      aws.String(header.Key),
+		UploadId: aws.String(header.UploadId),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, p := range page.Parts {
+			uploaded[aws.Int64Value(p.PartNumber)] = unquoteETag(p.ETag)
+		}
+		return true
+	})
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			// the upload was completed, aborted or expired
+			return nil, nil
+		}
+		return nil, err
+	}
+	return uploaded, nil
+}
+
+// upload the supplied parts concurrently, recording each one in the state once it is uploaded
+func (impl *uvaS3Impl) uploadParts(ctx context.Context, file *os.File, state *uploadState, pending []int64) error {
+	return forEachConcurrently(ctx, len(pending), uploadConcurrency, func(ctx context.Context, ix int) error {
+		return impl.uploadPart(ctx, file, state, pending[ix])
+	})
+}
+
+// upload one part from the source file
+func (impl *uvaS3Impl) uploadPart(ctx context.Context, file *os.File, state *uploadState, part int64) error {
+
+	offset := (part - 1) * state.header.PartSize
+	length := state.header.PartSize
+	if offset+length > state.header.Size {
+		length = state.header.Size - offset
+	}
+
+	input := &s3.UploadPartInput{
+		Bucket:        aws.String(state.header.Bucket),
+		Key:           aws.String(state.header.Key),
+		UploadId:      aws.String(state.header.UploadId),
+		PartNumber:    aws.Int64(part),
+		ContentLength: aws.Int64(length),
+		Body:          io.NewSectionReader(file, offset, length),
+	}
+
+	// the SDK does not compute additional checksums so we do it ourselves
+	checksum := ""
+	if len(state.header.Checksum) != 0 {
+		var err error
+		checksum, err = checksumOf(state.header.Checksum, io.NewSectionReader(file, offset, length))
+		if err != nil {
+			return err
+		}
+		setPartChecksum(input, state.header.Checksum, checksum)
+	}
+
+	// and S3 validates the part against the MD5 we send
+	digest := md5.New()
+	_, err := io.Copy(digest, io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return err
+	}
+	input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(digest.Sum(nil)))
+
+	result, err := impl.svc.UploadPartWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	return state.complete(uploadStatePart{Part: part, ETag: unquoteETag(result.ETag), Checksum: checksum})
+}
+
+// abort a multipart upload so its parts are not left lying around, the context may already be cancelled so
+// we abort without it
+func (impl *uvaS3Impl) abortUpload(header uploadStateHeader) {
+	_, err := impl.svc.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(header.Bucket),
+		Key:      aws.String(header.Key),
+		UploadId: aws.String(header.UploadId),
+	})
+	if err != nil {
+		impl.logWarn(fmt.Sprintf("abort of upload %s failed (%s)", header.UploadId, err.Error()))
+	}
+}
+
+// a digest of the put options so we only continue an upload created with the same options
+func putOptionsDigest(options UvaS3PutOptions) string {
+	// maps are encoded in key order so the encoding is stable
+	b, _ := json.Marshal(options)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// the part size for a resumable upload of the supplied size, increased if necessary to stay within the part
+// count limit
+func uploadPartSizeFor(size int64) int64 {
+	partSize := uploadPartSize
+	for (size+partSize-1)/partSize > maxUploadParts {
+		partSize += uploadPartSize
+	}
+	return partSize
+}
+
+// create a new state file for an upload
+func newUploadState(name string, header uploadStateHeader) (*uploadState, error) {
+
+	file, err := createJSONLines(name, header)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadState{header: header, parts: make(map[int64]uploadStatePart), file: file}, nil
+}
+
+// load the state of an earlier upload, returns nil if there is none
+func loadUploadState(name string) (*uploadState, error) {
+
+	var state uploadState
+	state.parts = make(map[int64]uploadStatePart)
+
+	_, err := readJSONLines(name, &state.header, func(b []byte) error {
+		var p uploadStatePart
+		err := json.Unmarshal(b, &p)
+		if err != nil {
+			return err
+		}
+		if len(p.ETag) == 0 {
+			return fmt.Errorf("missing etag")
+		}
+		state.parts[p.Part] = p
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// reopen for append so we can record further progress
+	state.file, err = openJSONLines(name)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// record an uploaded part
+func (state *uploadState) complete(part uploadStatePart) error {
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.parts[part.Part] = part
+	if state.file == nil {
+		// the state is not persisted
+		return nil
+	}
+	return state.file.append(part)
+}
+
+func (state *uploadState) close() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.file != nil {
+		state.file.close()
+		state.file = nil
+	}
+}
+
+//
+// end of file
+//
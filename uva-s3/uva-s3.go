@@ -1,7 +1,9 @@
 package uva_s3
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"time"
 )
 
@@ -11,6 +13,22 @@ var ErrBadParameter = fmt.Errorf("bad parameter")
 var ErrNotFound = fmt.Errorf("the specified bucket or key does not exist")
 var ErrObjectInGlacier = fmt.Errorf("the specified object is archived in glacier")
 var ErrCannotRestore = fmt.Errorf("the specified object cannot be restored as it is NOT archived in glacier")
+var ErrBucketExists = fmt.Errorf("the specified bucket already exists")
+var ErrBucketNotEmpty = fmt.Errorf("the specified bucket is not empty")
+var ErrNotDeleted = fmt.Errorf("the specified object is not deleted")
+var ErrCopyVerifyFailed = fmt.Errorf("the copied object does not match the source object")
+var ErrSourceNotDeleted = fmt.Errorf("the object was copied but the source object could not be deleted")
+var ErrNotRestored = fmt.Errorf("the specified object is not restored")
+var ErrNotRestoring = fmt.Errorf("the specified object is not being restored")
+var ErrRestoreTimeout = fmt.Errorf("timeout waiting for the specified object to be restored")
+var ErrRestoreInProgress = fmt.Errorf("the specified object is already being restored")
+var ErrTierNotSupported = fmt.Errorf("the restore tier is not supported for the storage class of the specified object")
+var ErrExpeditedUnavailable = fmt.Errorf("insufficient capacity is available for an expedited restore")
+var ErrInvalidRange = fmt.Errorf("the requested range is not satisfiable for the specified object")
+var ErrObjectChanged = fmt.Errorf("the specified object has changed")
+var ErrReaderClosed = fmt.Errorf("the object reader is closed")
+var ErrChecksumMismatch = fmt.Errorf("the downloaded content does not match the checksum of the specified object")
+var ErrUploadVerifyFailed = fmt.Errorf("the uploaded object does not match the supplied content")
 
 type UvaS3 interface {
 	StatObject(UvaS3Object) (UvaS3Object, error) // get object attributes
@@ -20,18 +38,192 @@ type UvaS3 interface {
 	PutFromBuffer(UvaS3Object, []byte) error     // put contents of the supplied buffer to a named object
 	RestoreObject(UvaS3Object, int, int64) error // initiate the restore of an object from glacier
 	DeleteObject(UvaS3Object) error              // delete the named object
+
+	PutFromFileWithOptions(UvaS3Object, string, UvaS3PutOptions) error   // put contents of a file to the named object with the supplied options
+	PutFromBufferWithOptions(UvaS3Object, []byte, UvaS3PutOptions) error // put contents of the supplied buffer to a named object with the supplied options
+
+	GetReader(UvaS3Object) (io.ReadCloser, error)                           // stream the contents of an object, the caller must close the reader
+	PutFromReader(UvaS3Object, io.Reader) error                             // put contents of a stream of unknown length to the named object
+	PutFromReaderWithOptions(UvaS3Object, io.Reader, UvaS3PutOptions) error // put contents of a stream to the named object with the supplied options
+
+	// get a byte range of an object given an offset and length. A length of zero reads to the end of the object
+	// and a negative offset (with a zero length) reads that many bytes from the end of the object
+	GetRange(UvaS3Object, int64, int64) ([]byte, error)
+
+	OpenObject(UvaS3Object) (UvaS3ObjectReader, error)                                // open an object for random access
+	OpenObjectWithOptions(UvaS3Object, UvaS3ReaderOptions) (UvaS3ObjectReader, error) // open an object for random access with the supplied options
+
+	// get contents of an object to a local file, recording progress beside the file so an interrupted download
+	// can be continued by calling again (the download starts again from scratch if the object has changed)
+	GetToFileResumable(UvaS3Object, string) error
+
+	// put contents of a file to the named object using a multipart upload, recording progress beside the file so
+	// an interrupted upload can be continued by calling again (small files are uploaded in a single request)
+	PutFromFileResumable(UvaS3Object, string) error
+	PutFromFileResumableWithOptions(UvaS3Object, string, UvaS3PutOptions) error
+
+	// enumerate the objects below a prefix, calling the supplied function for each one (return false to stop)
+	// and returning the common prefixes when a delimiter is specified
+	ListObjects(string, string, string, func(UvaS3Object) bool) ([]string, error)
+
+	CreateBucket(string, string) error // create the named bucket in the specified region
+	DeleteBucket(string, bool) error   // delete the named bucket, optionally emptying it first
+	BucketExists(string) (bool, error) // does the named bucket exist
+	ListBuckets() ([]string, error)    // list the buckets owned by the caller
+
+	// enumerate every version and delete marker below a prefix, calling the supplied function for each one
+	// (return false to stop)
+	ListObjectVersions(string, string, func(UvaS3Object) bool) error
+
+	UndeleteObject(UvaS3Object) (UvaS3Object, error)                  // remove the delete marker(s) hiding an object and return the recovered object
+	UndeleteObjects(string, string, time.Time) ([]UvaS3Object, error) // recover every object below a prefix that was deleted after the specified time
+
+	DeleteObjects([]UvaS3Object) ([]UvaS3DeleteResult, error) // delete a batch of objects, reporting the result for each one
+
+	CopyObject(UvaS3Object, UvaS3Object, UvaS3CopyOptions) error // server side copy of an object
+	MoveObject(UvaS3Object, UvaS3Object) error                   // server side copy, verify and delete of the source object
+	ChangeStorageClass(UvaS3Object, UvaS3StorageClass) error     // change the storage class of an object in place
+
+	GetObjectTags(UvaS3Object) (map[string]string, error) // get the tags of an object
+	PutObjectTags(UvaS3Object, map[string]string) error   // replace the tags of an object
+	DeleteObjectTags(UvaS3Object) error                   // remove all the tags from an object
+
+	ExtendRestore(UvaS3Object, int64) error // extend the lifetime of a restored object to the specified days from now
+
+	// wait for an in progress restore to complete, polling according to the supplied policy, and return the restored object
+	WaitForRestore(context.Context, UvaS3Object, UvaS3PollPolicy) (UvaS3Object, error)
+
+	UpgradeRestore(UvaS3Object, int, int64) error // upgrade an in progress restore to a faster tier
+
+	// context aware variants of the above, cancelling the context abandons the operation
+	StatObjectWithContext(context.Context, UvaS3Object) (UvaS3Object, error)
+	GetToFileWithContext(context.Context, UvaS3Object, string) error
+	GetToBufferWithContext(context.Context, UvaS3Object) ([]byte, error)
+	PutFromFileWithContext(context.Context, UvaS3Object, string) error
+	PutFromBufferWithContext(context.Context, UvaS3Object, []byte) error
+	RestoreObjectWithContext(context.Context, UvaS3Object, int, int64) error
+	DeleteObjectWithContext(context.Context, UvaS3Object) error
+	ListObjectsWithContext(context.Context, string, string, string, func(UvaS3Object) bool) ([]string, error)
+	CreateBucketWithContext(context.Context, string, string) error
+	DeleteBucketWithContext(context.Context, string, bool) error
+	BucketExistsWithContext(context.Context, string) (bool, error)
+	ListBucketsWithContext(context.Context) ([]string, error)
+	ListObjectVersionsWithContext(context.Context, string, string, func(UvaS3Object) bool) error
+	UndeleteObjectWithContext(context.Context, UvaS3Object) (UvaS3Object, error)
+	UndeleteObjectsWithContext(context.Context, string, string, time.Time) ([]UvaS3Object, error)
+	DeleteObjectsWithContext(context.Context, []UvaS3Object) ([]UvaS3DeleteResult, error)
+	CopyObjectWithContext(context.Context, UvaS3Object, UvaS3Object, UvaS3CopyOptions) error
+	MoveObjectWithContext(context.Context, UvaS3Object, UvaS3Object) error
+	ChangeStorageClassWithContext(context.Context, UvaS3Object, UvaS3StorageClass) error
+	GetObjectTagsWithContext(context.Context, UvaS3Object) (map[string]string, error)
+	PutObjectTagsWithContext(context.Context, UvaS3Object, map[string]string) error
+	DeleteObjectTagsWithContext(context.Context, UvaS3Object) error
+	ExtendRestoreWithContext(context.Context, UvaS3Object, int64) error
+	UpgradeRestoreWithContext(context.Context, UvaS3Object, int, int64) error
+	GetReaderWithContext(context.Context, UvaS3Object) (io.ReadCloser, error)
+	PutFromReaderWithContext(context.Context, UvaS3Object, io.Reader) error
+	GetRangeWithContext(context.Context, UvaS3Object, int64, int64) ([]byte, error)
+	OpenObjectWithContext(context.Context, UvaS3Object) (UvaS3ObjectReader, error)
+	GetToFileResumableWithContext(context.Context, UvaS3Object, string) error
+	PutFromFileResumableWithContext(context.Context, UvaS3Object, string) error
+
+	// context aware variants of the WithOptions methods
+	PutFromFileWithOptionsContext(context.Context, UvaS3Object, string, UvaS3PutOptions) error
+	PutFromBufferWithOptionsContext(context.Context, UvaS3Object, []byte, UvaS3PutOptions) error
+	PutFromReaderWithOptionsContext(context.Context, UvaS3Object, io.Reader, UvaS3PutOptions) error
+	OpenObjectWithOptionsContext(context.Context, UvaS3Object, UvaS3ReaderOptions) (UvaS3ObjectReader, error)
+	PutFromFileResumableWithOptionsContext(context.Context, UvaS3Object, string, UvaS3PutOptions) error
 }
 
 type UvaS3Object interface {
 	BucketName() string      // the name of the containing bucket
 	KeyName() string         // the key
-	IsGlacier() bool         // is the object stored in glacier
+	VersionId() string       // the version id (empty when not a specific version)
+	IsLatest() bool          // is this the latest version (from ListObjectVersions)
+	IsDeleteMarker() bool    // is this a delete marker (from ListObjectVersions)
+	IsGlacier() bool         // is the object stored in glacier (or an intelligent tiering archive tier)
 	IsRestoring() bool       // is the object currently being restored
 	IsRestored() bool        // has the object been restored
 	Size() int64             // object size
 	LastModified() time.Time // last modified time
+	ETag() string            // the entity tag (without quotes)
+
+	StorageClass() UvaS3StorageClass // the storage class
+	ContentType() string             // the Content-Type header
+	Metadata() map[string]string     // user metadata (the x-amz-meta-* headers, keys in lower case)
+	ServerSideEncryption() string    // the server side encryption algorithm (AES256, aws:kms, etc), empty if none
+	SSEKMSKeyId() string             // the KMS key id when encrypted using aws:kms
+	ReplicationStatus() string       // the replication status (COMPLETE, PENDING, FAILED, REPLICA), empty if not replicated
+	ExpiryDate() time.Time           // when a lifecycle rule will expire the object (zero if no rule applies)
+	ExpiryRule() string              // the id of the lifecycle rule that will expire the object
+	RestoreExpiry() time.Time        // when the restored copy will be removed (zero if not restored)
+	ArchiveStatus() string           // the intelligent tiering archive tier (ARCHIVE_ACCESS or DEEP_ARCHIVE_ACCESS), empty if not archived
+
+	// the additional checksums stored with the object (base64 encoded, the checksums of multipart uploads are
+	// checksums of the part checksums and end with -N where N is the part count)
+	Checksums() map[UvaS3ChecksumAlgorithm]string
+}
+
+// UvaS3StorageClass the S3 storage class of an object
+type UvaS3StorageClass string
+
+// the S3 storage classes
+const (
+	STORAGE_CLASS_STANDARD            UvaS3StorageClass = "STANDARD"
+	STORAGE_CLASS_REDUCED_REDUNDANCY  UvaS3StorageClass = "REDUCED_REDUNDANCY"
+	STORAGE_CLASS_STANDARD_IA         UvaS3StorageClass = "STANDARD_IA"
+	STORAGE_CLASS_ONEZONE_IA          UvaS3StorageClass = "ONEZONE_IA"
+	STORAGE_CLASS_INTELLIGENT_TIERING UvaS3StorageClass = "INTELLIGENT_TIERING"
+	STORAGE_CLASS_GLACIER_IR          UvaS3StorageClass = "GLACIER_IR"
+	STORAGE_CLASS_GLACIER             UvaS3StorageClass = "GLACIER"
+	STORAGE_CLASS_DEEP_ARCHIVE        UvaS3StorageClass = "DEEP_ARCHIVE"
+)
+
+// UvaS3ChecksumAlgorithm an S3 additional checksum algorithm
+type UvaS3ChecksumAlgorithm string
+
+// the S3 additional checksum algorithms
+const (
+	CHECKSUM_CRC32  UvaS3ChecksumAlgorithm = "CRC32"
+	CHECKSUM_CRC32C UvaS3ChecksumAlgorithm = "CRC32C"
+	CHECKSUM_SHA1   UvaS3ChecksumAlgorithm = "SHA1"
+	CHECKSUM_SHA256 UvaS3ChecksumAlgorithm = "SHA256"
+)
+
+// UvaS3PutOptions options for a put
+type UvaS3PutOptions struct {
+	ContentType        string            // the Content-Type header, S3 uses binary/octet-stream if empty
+	ContentDisposition string            // the Content-Disposition header
+	CacheControl       string            // the Cache-Control header
+	ContentEncoding    string            // the Content-Encoding header
+	Metadata           map[string]string // user metadata (stored as x-amz-meta-* headers)
+	StorageClass       UvaS3StorageClass // the storage class, S3 uses STANDARD if empty
+	Tags               map[string]string // tags applied to the object as it is created
 
-	// more stuff
+	// an additional checksum to compute and store with the object, it is validated by S3 on upload and by
+	// GetToFile and GetToBuffer on download (not supported by PutFromReader)
+	Checksum UvaS3ChecksumAlgorithm
+}
+
+// UvaS3CopyOptions options for a server side copy
+type UvaS3CopyOptions struct {
+	StorageClass    UvaS3StorageClass // the destination storage class, empty to preserve the source storage class
+	ReplaceMetadata bool              // replace the source user metadata with the supplied metadata rather than preserving it
+	Metadata        map[string]string // the destination user metadata (when ReplaceMetadata is set)
+}
+
+// UvaS3PollPolicy how we poll when waiting for a restore, zero values use the defaults
+type UvaS3PollPolicy struct {
+	InitialInterval time.Duration // the first poll interval (default 1 minute)
+	MaxInterval     time.Duration // the maximum poll interval (default 15 minutes)
+	Multiplier      float64       // the poll interval multiplier applied after each poll (default 2)
+	Timeout         time.Duration // how long to wait before giving up, zero to wait until the context is done
+}
+
+// UvaS3DeleteResult the outcome of deleting one object in a batch
+type UvaS3DeleteResult struct {
+	Object UvaS3Object // the object
+	Err    error       // nil if the object was deleted
 }
 
 // used for the type of restore
@@ -45,6 +237,14 @@ const (
 // UvaS3Config our configuration structure
 type UvaS3Config struct {
 	Logging bool // do we log
+
+	// when getting an archived object, restore it, wait for the restore to complete and then get it
+	AutoRestore     bool            // do we restore archived objects automatically
+	AutoRestoreTier int             // the restore tier (RESTORE_EXPEDITED unless specified, standard when not supported)
+	AutoRestoreDays int64           // how many days the restored copy remains available (default 1)
+	AutoRestorePoll UvaS3PollPolicy // how we poll for restore completion
+
+	ExpeditedFallback bool // fall back to a standard restore when an expedited restore is unavailable
 }
 
 // NewUvaS3 factory for our S3 interface
@@ -60,6 +260,11 @@ func NewUvaS3Object(bucketName string, keyName string) UvaS3Object {
 	return newUvaS3Object(bucketName, keyName)
 }
 
+// NewUvaS3ObjectVersion factory for a specific version of an S3 object
+func NewUvaS3ObjectVersion(bucketName string, keyName string, versionId string) UvaS3Object {
+	return newUvaS3ObjectVersion(bucketName, keyName, versionId)
+}
+
 //
 // end of file
 //
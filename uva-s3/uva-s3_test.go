@@ -1,9 +1,28 @@
 package uva_s3
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 var logging = false
@@ -13,9 +32,11 @@ var localSinkFile = "xxx"
 var goodBucketName = "uva-dpg3k-scratch"
 var badBucketName = "hurungl-zit0"
 var goodObjectName = "good-object"
+var copyObjectName = "good-object-copy"
 var badObjectName = "bad-object"
 var glacierBucketName = "dpg-archive-staging"
 var glacierKeyName = "000031989/000031989_0002.tif"
+var versionedBucketName = "uva-dpg3k-scratch-versioned"
 
 //
 // StatObject method invariant tests
@@ -61,6 +82,14 @@ func TestStatObjectStandardHappyDay(t *testing.T) {
 	if s.LastModified().IsZero() {
 		t.Fatalf("Unexpected last modified value. Expected non-zero, got %x\n", s.LastModified())
 	}
+
+	if len(s.ETag()) == 0 {
+		t.Fatalf("Unexpected etag value. Expected non-empty, got empty\n")
+	}
+
+	if s.StorageClass() != STORAGE_CLASS_STANDARD {
+		t.Fatalf("Unexpected storage class value. Expected %s, got %s\n", STORAGE_CLASS_STANDARD, s.StorageClass())
+	}
 }
 
 func TestStatObjectGlacierHappyDay(t *testing.T) {
@@ -93,6 +122,10 @@ func TestStatObjectGlacierHappyDay(t *testing.T) {
 		t.Fatalf("Unexpected restored value. Expected %t, got %t\n", false, s.IsRestored())
 	}
 
+	if s.RestoreExpiry().IsZero() == false {
+		t.Fatalf("Unexpected restore expiry value. Expected zero, got %s\n", s.RestoreExpiry())
+	}
+
 	if s.Size() == 0 {
 		t.Fatalf("Unexpected size value. Expected non-zero, got %d\n", s.Size())
 	}
@@ -161,6 +194,32 @@ func TestGetToFileHappyDay(t *testing.T) {
 	}
 }
 
+func TestGetToFileLargerExistingFile(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available and a local sink file larger than it
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	o := goodS3Object()
+	s, err := uvas3.StatObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	err = ioutil.WriteFile(localSinkFile, make([]byte, s.Size()*2), 0644)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// the existing content is replaced
+	err = uvas3.GetToFile(o, localSinkFile)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	sz := fileSize(localSinkFile)
+	if sz != s.Size() {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", s.Size(), sz)
+	}
+}
+
 func TestGetToFileBadBucketName(t *testing.T) {
 	uvas3 := testSetup(t)
 
@@ -197,6 +256,277 @@ func TestGetToFileGlacierObject(t *testing.T) {
 	}
 }
 
+func TestGetToFileGlacierObjectKeepsExistingFile(t *testing.T) {
+
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		switch r.Operation.Name {
+		case "HeadObject":
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_GLACIER, ""), ""
+		case "GetObject":
+			return http.StatusForbidden, nil, stubErrorBody(s3.ErrCodeInvalidObjectState)
+		}
+		return http.StatusBadRequest, nil, stubErrorBody("Unexpected")
+	})
+
+	location := t.TempDir() + "/existing"
+	err := ioutil.WriteFile(location, []byte("existing content"), 0644)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = uvas3.GetToFile(goodGlacierS3Object(), location)
+	expected := ErrObjectInGlacier
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+
+	// the existing file is untouched
+	b, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if string(b) != "existing content" {
+		t.Fatalf("Unexpected content. Expected %s, got %s\n", "existing content", string(b))
+	}
+}
+
+func TestGetToFileAutoRestoreNotGlacier(t *testing.T) {
+	uvas3, err := NewUvaS3(UvaS3Config{Logging: logging, AutoRestore: true, AutoRestoreTier: RESTORE_BULK})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// ensure we have a test object available and delete the local sink file
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	deleteFile(localSinkFile)
+
+	// objects that are not archived are downloaded as usual
+	err = uvas3.GetToFile(goodS3Object(), localSinkFile)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify file size
+	sz := fileSize(localSinkFile)
+	if sz != fileSize(goodSourceFile) {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", fileSize(goodSourceFile), sz)
+	}
+}
+
+func TestGetToBufferAutoRestoreDeepArchive(t *testing.T) {
+
+	// a deep archive object that is available once the restore has been checked twice
+	var tier string
+	heads := 0
+	config := UvaS3Config{Logging: logging, AutoRestore: true, AutoRestorePoll: UvaS3PollPolicy{InitialInterval: time.Millisecond}}
+	uvas3 := stubS3(t, config, func(r *request.Request) (int, http.Header, string) {
+		switch r.Operation.Name {
+		case "HeadObject":
+			switch {
+			case len(tier) == 0:
+				return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, ""), ""
+			case heads == 0:
+				heads++
+				return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, `ongoing-request="true"`), ""
+			}
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, `ongoing-request="false", expiry-date="Fri, 21 Dec 2035 00:00:00 GMT"`), ""
+		case "RestoreObject":
+			tier = aws.StringValue(r.Params.(*s3.RestoreObjectInput).RestoreRequest.GlacierJobParameters.Tier)
+			return http.StatusAccepted, nil, ""
+		case "GetObject":
+			if heads == 0 {
+				return http.StatusForbidden, nil, stubErrorBody(s3.ErrCodeInvalidObjectState)
+			}
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, ""), stubContent
+		}
+		return http.StatusBadRequest, nil, stubErrorBody("Unexpected")
+	})
+
+	b, err := uvas3.GetToBuffer(goodGlacierS3Object())
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if string(b) != stubContent {
+		t.Fatalf("Unexpected content. Expected %s, got %s\n", stubContent, string(b))
+	}
+
+	// expedited (the default) is not available for deep archive
+	if tier != "Standard" {
+		t.Fatalf("Unexpected restore tier. Expected Standard, got %s\n", tier)
+	}
+}
+
+func TestGetToFileWithContextCancelled(t *testing.T) {
+
+	// the download is cancelled once the first part has been written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	location := t.TempDir() + "/partial"
+	partial := false
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		switch r.Operation.Name {
+		case "HeadObject":
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_STANDARD, ""), ""
+		case "GetObject":
+			if aws.StringValue(r.Params.(*s3.GetObjectInput).Range) == "bytes=0-3" {
+				header := http.Header{}
+				header.Set("Content-Range", fmt.Sprintf("bytes 0-3/%d", len(stubContent)))
+				return http.StatusPartialContent, header, stubContent[0:4]
+			}
+			partial = fileExists(location)
+			cancel()
+			return 0, nil, ""
+		}
+		return http.StatusBadRequest, nil, stubErrorBody("Unexpected")
+	})
+	uvas3.downloader.PartSize = 4
+	uvas3.downloader.Concurrency = 1
+
+	// a cancelled download fails and leaves no partial output
+	err := uvas3.GetToFileWithContext(ctx, goodS3Object(), location)
+	if err == nil {
+		t.Fatalf("Unexpected success. Expected error, got nil\n")
+	}
+	if partial == false {
+		t.Fatalf("Expected partial results file does not exist\n")
+	}
+	if fileExists(location) == true {
+		t.Fatalf("Unexpected partial results file\n")
+	}
+}
+
+func TestStatObjectWithContextTimeout(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	_, err := uvas3.StatObjectWithContext(ctx, goodS3Object())
+	if err == nil {
+		t.Fatalf("Unexpected success. Expected error, got nil\n")
+	}
+}
+
+func TestGetToFileResumableHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available and delete the local sink file
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	deleteFile(localSinkFile)
+
+	err := uvas3.GetToFileResumable(goodS3Object(), localSinkFile)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify file size
+	sz := fileSize(localSinkFile)
+	if sz != fileSize(goodSourceFile) {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", fileSize(goodSourceFile), sz)
+	}
+
+	// the download state is removed once complete
+	if fileExists(localSinkFile+downloadStateSuffix) == true {
+		t.Fatalf("Unexpected download state file\n")
+	}
+}
+
+func TestGetToFileResumableBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.GetToFileResumable(badKeyS3Object(), localSinkFile)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestDownloadState(t *testing.T) {
+
+	name := localSinkFile + downloadStateSuffix
+	defer deleteFile(name)
+
+	// record some progress
+	header := downloadStateHeader{Bucket: goodBucketName, Key: goodObjectName, ETag: "abc", Size: 100, PartSize: 10}
+	state, err := newDownloadState(name, header)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	_ = state.complete(3)
+	_ = state.complete(7)
+	state.close()
+
+	// and load it again
+	state, err = loadDownloadState(name)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer state.close()
+
+	if state.header != header {
+		t.Fatalf("Unexpected header. Expected %v, got %v\n", header, state.header)
+	}
+	if len(state.done) != 2 || state.done[3] == false || state.done[7] == false {
+		t.Fatalf("Unexpected parts. Expected [3 7], got %v\n", state.done)
+	}
+}
+
+func TestDownloadStatePartialWrite(t *testing.T) {
+
+	name := localSinkFile + downloadStateSuffix
+	defer deleteFile(name)
+
+	header := downloadStateHeader{Bucket: goodBucketName, Key: goodObjectName, ETag: "abc", Size: 100, PartSize: 10}
+	state, err := newDownloadState(name, header)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	_ = state.complete(3)
+	state.close()
+
+	// simulate being interrupted while recording a part
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	_, _ = file.WriteString(`{"part":`)
+	file.Close()
+
+	state, err = loadDownloadState(name)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer state.close()
+
+	if len(state.done) != 1 || state.done[3] == false {
+		t.Fatalf("Unexpected parts. Expected [3], got %v\n", state.done)
+	}
+}
+
+func TestForEachConcurrentlyStopsOnError(t *testing.T) {
+
+	var m sync.Mutex
+	done := 0
+	expected := ErrBadParameter
+	err := forEachConcurrently(context.Background(), 100, 1, func(ctx context.Context, ix int) error {
+		m.Lock()
+		defer m.Unlock()
+		done++
+		if ix == 2 {
+			return expected
+		}
+		return nil
+	})
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+
+	// a single worker means at most one more item was dispatched after the failure
+	if done > 4 {
+		t.Fatalf("Unexpected work. Expected dispatch to stop after the error, got %d items\n", done)
+	}
+}
+
 //
 // GetToBuffer method invariant tests
 //
@@ -317,22 +647,18 @@ func TestPutFromFileBadFileName(t *testing.T) {
 	}
 }
 
-//
-// PutFromBuffer method invariant tests
-//
-
-func TestPutFromBufferHappyDay(t *testing.T) {
+func TestPutFromFileWithOptionsHappyDay(t *testing.T) {
 	uvas3 := testSetup(t)
 
-	// delete the object
 	o := goodS3Object()
-	err := uvas3.DeleteObject(o)
-	if err != nil {
-		t.Fatalf("%s\n", err.Error())
+	options := UvaS3PutOptions{
+		ContentType:        "text/plain",
+		ContentDisposition: "attachment; filename=\"Makefile\"",
+		CacheControl:       "no-cache",
+		Metadata:           map[string]string{"source": "makefile"},
+		StorageClass:       STORAGE_CLASS_STANDARD_IA,
 	}
-
-	b := bufferFromFile(t, goodSourceFile)
-	err = uvas3.PutFromBuffer(o, b)
+	err := uvas3.PutFromFileWithOptions(o, goodSourceFile, options)
 	if err != nil {
 		t.Fatalf("%s\n", err.Error())
 	}
@@ -348,126 +674,1898 @@ func TestPutFromBufferHappyDay(t *testing.T) {
 	if sz != s.Size() {
 		t.Fatalf("Unexpected size. Expected %d, got %d\n", s.Size(), sz)
 	}
-}
-
-func TestPutFromBufferBadBucketName(t *testing.T) {
-	uvas3 := testSetup(t)
 
-	// get the object details
-	o := badBucketS3Object()
-	b := make([]byte, 0, 10)
-	err := uvas3.PutFromBuffer(o, b)
-	expected := ErrNotFound
-	if err != expected {
-		errorEvaluate(t, expected, err)
+	// verify the options were applied
+	if s.ContentType() != options.ContentType {
+		t.Fatalf("Unexpected content type. Expected %s, got %s\n", options.ContentType, s.ContentType())
+	}
+	if s.StorageClass() != options.StorageClass {
+		t.Fatalf("Unexpected storage class. Expected %s, got %s\n", options.StorageClass, s.StorageClass())
+	}
+	if s.Metadata()["source"] != options.Metadata["source"] {
+		t.Fatalf("Unexpected metadata. Expected %s, got %s\n", options.Metadata["source"], s.Metadata()["source"])
 	}
 }
 
-//
-// RestoreObject method invariant tests
-//
-
-func TestRestoreObjectHappyDay(t *testing.T) {
-	//uvas3 := testSetup(t)
-	// LATER
-}
-
-func TestRestoreObjectNotGlacier(t *testing.T) {
+func TestPutFromFileWithOptionsBadStorageClass(t *testing.T) {
 	uvas3 := testSetup(t)
 
-	// get the object details
-	o := goodS3Object()
-	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
-	expected := ErrCannotRestore
+	err := uvas3.PutFromFileWithOptions(goodS3Object(), goodSourceFile, UvaS3PutOptions{StorageClass: UvaS3StorageClass("BAD")})
+	expected := ErrBadParameter
 	if err != expected {
 		errorEvaluate(t, expected, err)
 	}
 }
 
-func TestRestoreObjectBadBucketName(t *testing.T) {
+func TestPutFromFileResumableHappyDay(t *testing.T) {
 	uvas3 := testSetup(t)
 
-	// get the object details
-	o := badBucketS3Object()
-	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
-	expected := ErrNotFound
-	if err != expected {
-		errorEvaluate(t, expected, err)
+	o := goodS3Object()
+	err := uvas3.PutFromFileResumable(o, goodSourceFile)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
 	}
-}
 
-func TestRestoreObjectBadKeyName(t *testing.T) {
-	uvas3 := testSetup(t)
+	// get uploaded object details
+	s, err := uvas3.StatObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
 
-	// get the object details
-	o := badKeyS3Object()
-	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
-	expected := ErrNotFound
-	if err != expected {
-		errorEvaluate(t, expected, err)
+	// verify file size
+	sz := fileSize(goodSourceFile)
+	if sz != s.Size() {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", sz, s.Size())
 	}
 }
 
-func TestRestoreObjectBadTier(t *testing.T) {
+func TestPutFromFileResumableBadFileName(t *testing.T) {
 	uvas3 := testSetup(t)
 
-	// get the object details
-	o := goodS3Object()
-	err := uvas3.RestoreObject(o, RESTORE_UNDEFINED, 1)
-	expected := ErrBadParameter
+	err := uvas3.PutFromFileResumable(goodS3Object(), badSourceFile)
+	expected := os.ErrNotExist
 	if err != expected {
 		errorEvaluate(t, expected, err)
 	}
 }
 
-//
-// DeleteObject method invariant tests
-//
+func TestUploadState(t *testing.T) {
 
-func TestDeleteObjectHappyDay(t *testing.T) {
-	uvas3 := testSetup(t)
+	name := localSinkFile + uploadStateSuffix
+	defer deleteFile(name)
 
-	// ensure we have a test object available and delete the local sink file
-	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	// record some progress
+	header := uploadStateHeader{Bucket: goodBucketName, Key: goodObjectName, UploadId: "xyz", Size: 100,
+		ModTime: time.Now().UTC().Truncate(time.Second), PartSize: 10}
+	state, err := newUploadState(name, header)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	_ = state.complete(uploadStatePart{Part: 1, ETag: "etag-1"})
+	_ = state.complete(uploadStatePart{Part: 4, ETag: "etag-4", Checksum: "abc="})
+	state.close()
 
-	// delete the object
-	o := goodS3Object()
-	err := uvas3.DeleteObject(o)
+	// and load it again
+	state, err = loadUploadState(name)
 	if err != nil {
 		t.Fatalf("%s\n", err.Error())
 	}
+	defer state.close()
 
-	// verify object does not exist
-	if objectExists(t, uvas3, o) != false {
-		t.Fatalf("Object was not deleted successfully\n")
+	if state.header != header {
+		t.Fatalf("Unexpected header. Expected %v, got %v\n", header, state.header)
+	}
+	if len(state.parts) != 2 || state.parts[1].ETag != "etag-1" || state.parts[4].Checksum != "abc=" {
+		t.Fatalf("Unexpected parts. Expected [1 4], got %v\n", state.parts)
 	}
 }
 
-func TestDeleteObjectBadBucketName(t *testing.T) {
-	uvas3 := testSetup(t)
+func TestUploadStateNotPersisted(t *testing.T) {
 
-	// get the object
-	o := badBucketS3Object()
-	err := uvas3.DeleteObject(o)
-	expected := ErrNotFound
-	if err != expected {
-		errorEvaluate(t, expected, err)
+	// a state that is only kept in memory records progress without a state file
+	state := &uploadState{header: uploadStateHeader{UploadId: "xyz", Size: 100, PartSize: 10}, parts: make(map[int64]uploadStatePart)}
+	err := state.complete(uploadStatePart{Part: 2, ETag: "etag-2"})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	state.close()
+
+	if len(state.parts) != 1 || state.parts[2].ETag != "etag-2" {
+		t.Fatalf("Unexpected parts. Expected [2], got %v\n", state.parts)
+	}
+}
+
+func TestPutOptionsDigest(t *testing.T) {
+
+	options := UvaS3PutOptions{ContentType: "text/plain", Metadata: map[string]string{"a": "1", "b": "2"}, Tags: map[string]string{"x": "y"}}
+	digest := putOptionsDigest(options)
+	if putOptionsDigest(options) != digest {
+		t.Fatalf("Unexpected digest. Expected %s, got %s\n", digest, putOptionsDigest(options))
+	}
+
+	// any change to the options changes the digest
+	for _, changed := range []UvaS3PutOptions{
+		{ContentType: "text/html", Metadata: options.Metadata, Tags: options.Tags},
+		{ContentType: options.ContentType, Metadata: map[string]string{"a": "1"}, Tags: options.Tags},
+		{ContentType: options.ContentType, Metadata: options.Metadata, Tags: map[string]string{"x": "z"}},
+		{ContentType: options.ContentType, Metadata: options.Metadata, Tags: options.Tags, StorageClass: STORAGE_CLASS_GLACIER},
+	} {
+		if putOptionsDigest(changed) == digest {
+			t.Fatalf("Unexpected digest. Expected a change for %+v\n", changed)
+		}
+	}
+}
+
+func TestUploadPartSizeFor(t *testing.T) {
+
+	if uploadPartSizeFor(uploadPartSize) != uploadPartSize {
+		t.Fatalf("Unexpected part size. Expected %d, got %d\n", uploadPartSize, uploadPartSizeFor(uploadPartSize))
+	}
+
+	// very large files use larger parts to stay within the part limit
+	size := int64(5 * 1024 * 1024 * 1024 * 1024)
+	partSize := uploadPartSizeFor(size)
+	if (size+partSize-1)/partSize > maxUploadParts {
+		t.Fatalf("Unexpected part count. Expected at most %d, got %d\n", maxUploadParts, (size+partSize-1)/partSize)
+	}
+}
+
+//
+// PutFromBuffer method invariant tests
+//
+
+func TestPutFromBufferHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// delete the object
+	o := goodS3Object()
+	err := uvas3.DeleteObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	b := bufferFromFile(t, goodSourceFile)
+	err = uvas3.PutFromBuffer(o, b)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// get uploaded object details
+	s, err := uvas3.StatObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify file size
+	sz := fileSize(goodSourceFile)
+	if sz != s.Size() {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", s.Size(), sz)
+	}
+}
+
+func TestPutFromBufferBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object details
+	o := badBucketS3Object()
+	b := make([]byte, 0, 10)
+	err := uvas3.PutFromBuffer(o, b)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// GetReader and PutFromReader method invariant tests
+//
+
+func TestStreamingHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// upload from a stream
+	o := goodS3Object()
+	file, err := os.Open(goodSourceFile)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer file.Close()
+
+	err = uvas3.PutFromReader(o, file)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// and stream it back
+	reader, err := uvas3.GetReader(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer reader.Close()
+
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify the size
+	sz := fileSize(goodSourceFile)
+	if sz != int64(len(b)) {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", sz, len(b))
+	}
+}
+
+func TestGetReaderBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.GetReader(badKeyS3Object())
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestGetReaderGlacierObject(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.GetReader(goodGlacierS3Object())
+	expected := ErrObjectInGlacier
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestPutFromReaderBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.PutFromReader(badBucketS3Object(), strings.NewReader("hello"))
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestPutFromReaderBadParameter(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.PutFromReader(goodS3Object(), nil)
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// GetRange method invariant tests
+//
+
+func TestGetRangeHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	b := bufferFromFile(t, goodSourceFile)
+
+	// the head of the object
+	buf, err := uvas3.GetRange(goodS3Object(), 0, 10)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if string(buf) != string(b[:10]) {
+		t.Fatalf("Unexpected content. Expected %q, got %q\n", string(b[:10]), string(buf))
+	}
+
+	// the tail of the object
+	buf, err = uvas3.GetRange(goodS3Object(), -10, 0)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if string(buf) != string(b[len(b)-10:]) {
+		t.Fatalf("Unexpected content. Expected %q, got %q\n", string(b[len(b)-10:]), string(buf))
+	}
+
+	// from an offset to the end of the object
+	buf, err = uvas3.GetRange(goodS3Object(), 10, 0)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if len(buf) != len(b)-10 {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", len(b)-10, len(buf))
+	}
+}
+
+func TestGetRangePastEnd(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	_, err := uvas3.GetRange(goodS3Object(), fileSize(goodSourceFile), 10)
+	expected := ErrInvalidRange
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestGetRangeBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.GetRange(badKeyS3Object(), 0, 10)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestGetRangeBadParameter(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.GetRange(goodS3Object(), -10, 5)
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestRangeHeader(t *testing.T) {
+
+	tests := []struct {
+		offset int64
+		length int64
+		header string
+		ok     bool
+	}{
+		{0, 10, "bytes=0-9", true},
+		{100, 1, "bytes=100-100", true},
+		{100, 0, "bytes=100-", true},
+		{-500, 0, "bytes=-500", true},
+		{-500, 10, "", false},
+		{0, -1, "", false},
+	}
+
+	for _, test := range tests {
+		header, ok := rangeHeader(test.offset, test.length)
+		if header != test.header || ok != test.ok {
+			t.Fatalf("Unexpected range for %d/%d. Expected %q/%t, got %q/%t\n", test.offset, test.length, test.header, test.ok, header, ok)
+		}
+	}
+}
+
+//
+// OpenObject method invariant tests
+//
+
+func TestOpenObjectHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	b := bufferFromFile(t, goodSourceFile)
+
+	r, err := uvas3.OpenObjectWithOptions(goodS3Object(), UvaS3ReaderOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer r.Close()
+
+	// read the whole object sequentially
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if string(buf) != string(b) {
+		t.Fatalf("Unexpected content. Expected %d bytes, got %d bytes\n", len(b), len(buf))
+	}
+}
+
+func TestOpenObjectBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.OpenObject(badKeyS3Object())
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestOpenObjectGlacierObject(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.OpenObject(goodGlacierS3Object())
+	expected := ErrObjectInGlacier
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestObjectReader(t *testing.T) {
+
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var gets int32
+	var m sync.Mutex
+	get := func(ctx context.Context, byteRange string) (io.ReadCloser, error) {
+		m.Lock()
+		gets++
+		m.Unlock()
+		var from, to int
+		_, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &from, &to)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader(string(content[from : to+1]))), nil
+	}
+
+	r, err := newUvaS3ObjectReader(context.Background(), int64(len(content)), UvaS3ReaderOptions{BlockSize: 5, CacheBlocks: 4, ReadAhead: -1}, get)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// a read spanning several blocks
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, 3)
+	if err != nil || string(buf[:n]) != "3456789abcde" {
+		t.Fatalf("Unexpected read. Expected %q, got %q (%v)\n", "3456789abcde", string(buf[:n]), err)
+	}
+
+	// a read within the cached blocks costs nothing
+	before := gets
+	_, err = r.ReadAt(buf[:4], 6)
+	if err != nil || gets != before {
+		t.Fatalf("Unexpected gets. Expected %d, got %d (%v)\n", before, gets, err)
+	}
+
+	// a read past the end of the object
+	n, err = r.ReadAt(buf, 30)
+	if err != io.EOF || string(buf[:n]) != "uvwxyz" {
+		t.Fatalf("Unexpected read. Expected %q/EOF, got %q (%v)\n", "uvwxyz", string(buf[:n]), err)
+	}
+
+	// seek and read
+	off, err := r.Seek(-3, io.SeekEnd)
+	if err != nil || off != int64(len(content)-3) {
+		t.Fatalf("Unexpected seek. Expected %d, got %d (%v)\n", len(content)-3, off, err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || string(rest) != "xyz" {
+		t.Fatalf("Unexpected read. Expected %q, got %q (%v)\n", "xyz", string(rest), err)
+	}
+
+	// closed readers fail
+	_ = r.Close()
+	_, err = r.ReadAt(buf, 0)
+	expected := ErrReaderClosed
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// checksum invariant tests
+//
+
+func TestChecksumsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	for _, algorithm := range []UvaS3ChecksumAlgorithm{CHECKSUM_CRC32, CHECKSUM_CRC32C, CHECKSUM_SHA1, CHECKSUM_SHA256} {
+
+		// upload with the checksum
+		o := goodS3Object()
+		err := uvas3.PutFromFileWithOptions(o, goodSourceFile, UvaS3PutOptions{Checksum: algorithm})
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+
+		// check it is stored with the object
+		s, err := uvas3.StatObject(o)
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+		file, _ := os.Open(goodSourceFile)
+		expected, _ := checksumOf(algorithm, file)
+		file.Close()
+		if s.Checksums()[algorithm] != expected {
+			t.Fatalf("Unexpected %s checksum. Expected %s, got %s\n", algorithm, expected, s.Checksums()[algorithm])
+		}
+
+		// and validated on download
+		_, err = uvas3.GetToBuffer(o)
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+	}
+}
+
+func TestChecksumsBadAlgorithm(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.PutFromFileWithOptions(goodS3Object(), goodSourceFile, UvaS3PutOptions{Checksum: "MD4"})
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestChecksumOf(t *testing.T) {
+
+	tests := map[UvaS3ChecksumAlgorithm]string{
+		CHECKSUM_CRC32:  "y/Q5Jg==",
+		CHECKSUM_CRC32C: "4waSgw==",
+		CHECKSUM_SHA1:   "98O8HYCOBHMq32eZZczDTKeuNEE=",
+		CHECKSUM_SHA256: "FeKw08M4keuw8e9gnsQZQgwg4yDOlMZfvIwzEkSOsiU=",
+	}
+
+	for algorithm, expected := range tests {
+		actual, err := checksumOf(algorithm, strings.NewReader("123456789"))
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+		if actual != expected {
+			t.Fatalf("Unexpected %s checksum. Expected %s, got %s\n", algorithm, expected, actual)
+		}
+	}
+}
+
+func TestValidateChecksums(t *testing.T) {
+
+	content := strings.NewReader("123456789")
+
+	// full object checksums are validated
+	o := uvaS3ObjectImpl{checksums: map[UvaS3ChecksumAlgorithm]string{CHECKSUM_CRC32: "y/Q5Jg=="}}
+	err := validateChecksums(o, content)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	o = uvaS3ObjectImpl{checksums: map[UvaS3ChecksumAlgorithm]string{CHECKSUM_CRC32: "AAAAAA=="}}
+	err = validateChecksums(o, content)
+	expected := ErrChecksumMismatch
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+
+	// the checksums of multipart uploads are not
+	o = uvaS3ObjectImpl{checksums: map[UvaS3ChecksumAlgorithm]string{CHECKSUM_CRC32: "AAAAAA==-3"}}
+	err = validateChecksums(o, content)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+}
+
+// the composite checksum and entity tag of the supplied content uploaded in parts of the supplied size,
+// computed independently of the implementation
+func testMultipartSums(content string, partSize int) (string, string) {
+	checksums := make([]byte, 0)
+	md5s := make([]byte, 0)
+	parts := 0
+	for off := 0; off < len(content); off += partSize {
+		end := off + partSize
+		if end > len(content) {
+			end = len(content)
+		}
+		c := sha256.Sum256([]byte(content[off:end]))
+		checksums = append(checksums, c[:]...)
+		m := md5.Sum([]byte(content[off:end]))
+		md5s = append(md5s, m[:]...)
+		parts++
+	}
+	c := sha256.Sum256(checksums)
+	m := md5.Sum(md5s)
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(c[:]), parts), fmt.Sprintf("%s-%d", hex.EncodeToString(m[:]), parts)
+}
+
+func TestCompositeChecksumOf(t *testing.T) {
+
+	for _, partSize := range []int{3, 5, 10} {
+		expected, _ := testMultipartSums(stubContent, partSize)
+		actual, err := compositeChecksumOf(CHECKSUM_SHA256, strings.NewReader(stubContent), int64(partSize))
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+		if actual != expected {
+			t.Fatalf("Unexpected checksum for part size %d. Expected %s, got %s\n", partSize, expected, actual)
+		}
+	}
+}
+
+func TestValidateContentMultipart(t *testing.T) {
+
+	// an object uploaded in parts of 4, 4 and 2 bytes
+	partSizes := []int64{4, 4, 2}
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		part := aws.Int64Value(r.Params.(*s3.HeadObjectInput).PartNumber)
+		header := http.Header{}
+		header.Set("Content-Length", fmt.Sprintf("%d", partSizes[part-1]))
+		header.Set("X-Amz-Mp-Parts-Count", "3")
+		return http.StatusOK, header, ""
+	})
+
+	checksum, etag := testMultipartSums(stubContent, 4)
+	o := uvaS3ObjectImpl{bucket: goodBucketName, key: goodObjectName, size: int64(len(stubContent)), etag: etag,
+		checksums: map[UvaS3ChecksumAlgorithm]string{CHECKSUM_SHA256: checksum}}
+
+	err := uvas3.validateContent(context.Background(), o, o, strings.NewReader(stubContent))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// corrupt content is detected by the checksum as well as the entity tag
+	corrupt := "0123456780"
+	err = uvas3.validateContent(context.Background(), o, o, strings.NewReader(corrupt))
+	expected := ErrChecksumMismatch
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+	o.etag = ""
+	err = uvas3.validateContent(context.Background(), o, o, strings.NewReader(corrupt))
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+
+	// but not reported when the parts are not all the same size
+	partSizes = []int64{4, 3, 3}
+	err = uvas3.validateContent(context.Background(), o, o, strings.NewReader(corrupt))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+}
+
+//
+// entity tag invariant tests
+//
+
+func TestETagHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	buf := bufferFromFile(t, goodSourceFile)
+	err := uvas3.PutFromBuffer(goodS3Object(), buf)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	o, err := uvas3.StatObject(goodS3Object())
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	sum := md5.Sum(buf)
+	expected := hex.EncodeToString(sum[:])
+	if o.ETag() != expected {
+		t.Fatalf("Unexpected etag. Expected %s, got %s\n", expected, o.ETag())
+	}
+
+	// and the download is validated against it
+	_, err = uvas3.GetToBuffer(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+}
+
+func TestCountingReaderETag(t *testing.T) {
+
+	content := "0123456789abcdefghij"
+
+	// a single part is the MD5 of the content
+	counter := newCountingReader(strings.NewReader(content), 64)
+	_, err := io.Copy(io.Discard, counter)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	sum := md5.Sum([]byte(content))
+	expected := hex.EncodeToString(sum[:])
+	if counter.etag(false) != expected {
+		t.Fatalf("Unexpected etag. Expected %s, got %s\n", expected, counter.etag(false))
+	}
+	if counter.count != int64(len(content)) {
+		t.Fatalf("Unexpected count. Expected %d, got %d\n", len(content), counter.count)
+	}
+
+	// multiple parts are the MD5 of the part MD5s followed by the part count
+	for _, partSize := range []int64{5, 7, 20} {
+		sums := make([]byte, 0)
+		for off := int64(0); off < int64(len(content)); off += partSize {
+			end := off + partSize
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			part := md5.Sum([]byte(content[off:end]))
+			sums = append(sums, part[:]...)
+		}
+		all := md5.Sum(sums)
+		expected = fmt.Sprintf("%s-%d", hex.EncodeToString(all[:]), len(sums)/md5.Size)
+
+		// read in small pieces so the reads straddle the part boundaries
+		counter = newCountingReader(iotest.OneByteReader(strings.NewReader(content)), partSize)
+		_, err = io.Copy(io.Discard, counter)
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+		if counter.etag(true) != expected {
+			t.Fatalf("Unexpected etag for part size %d. Expected %s, got %s\n", partSize, expected, counter.etag(true))
+		}
+	}
+}
+
+func TestUploaderPartSize(t *testing.T) {
+
+	uploader := s3manager.Uploader{}
+	if uploaderPartSize(uploader, 1024) != s3manager.DefaultUploadPartSize {
+		t.Fatalf("Unexpected part size for a small upload\n")
+	}
+
+	// the options apply
+	actual := uploaderPartSize(uploader, 1024, func(u *s3manager.Uploader) { u.PartSize = 2048 })
+	if actual != 2048 {
+		t.Fatalf("Unexpected part size. Expected 2048, got %d\n", actual)
+	}
+
+	// and the part size grows to keep within the part limit
+	size := s3manager.DefaultUploadPartSize * int64(s3manager.MaxUploadParts) * 2
+	actual = uploaderPartSize(uploader, size)
+	if (size+actual-1)/actual > int64(s3manager.MaxUploadParts) {
+		t.Fatalf("Unexpected part size %d for %d bytes\n", actual, size)
+	}
+}
+
+//
+// object tagging method invariant tests
+//
+
+func TestObjectTagsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	o := goodS3Object()
+
+	tags := map[string]string{"lifecycle": "archive", "project": "uva s3 sdk"}
+	err := uvas3.PutObjectTags(o, tags)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	verifyTestTags(t, uvas3, o, tags)
+
+	err = uvas3.DeleteObjectTags(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	verifyTestTags(t, uvas3, o, map[string]string{})
+}
+
+func TestPutFromFileWithTags(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	o := goodS3Object()
+	tags := map[string]string{"lifecycle": "scratch", "source": "file & buffer"}
+	err := uvas3.PutFromFileWithOptions(o, goodSourceFile, UvaS3PutOptions{Tags: tags})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	verifyTestTags(t, uvas3, o, tags)
+}
+
+func TestPutFromBufferWithTags(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	o := goodS3Object()
+	tags := map[string]string{"lifecycle": "scratch"}
+	err := uvas3.PutFromBufferWithOptions(o, bufferFromFile(t, goodSourceFile), UvaS3PutOptions{Tags: tags})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	verifyTestTags(t, uvas3, o, tags)
+}
+
+func TestGetObjectTagsBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.GetObjectTags(badKeyS3Object())
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestPutObjectTagsBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.PutObjectTags(badBucketS3Object(), map[string]string{"lifecycle": "scratch"})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// RestoreObject method invariant tests
+//
+
+func TestRestoreObjectHappyDay(t *testing.T) {
+	//uvas3 := testSetup(t)
+	// LATER
+}
+
+func TestRestoreObjectNotGlacier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object details
+	o := goodS3Object()
+	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
+	expected := ErrCannotRestore
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestRestoreObjectBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object details
+	o := badBucketS3Object()
+	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestRestoreObjectBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object details
+	o := badKeyS3Object()
+	err := uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestRestoreObjectBadTier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object details
+	o := goodS3Object()
+	err := uvas3.RestoreObject(o, RESTORE_UNDEFINED, 1)
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestValidRestoreTier(t *testing.T) {
+
+	deepArchive := uvaS3ObjectImpl{storageClass: STORAGE_CLASS_DEEP_ARCHIVE, isGlacier: true}
+	glacier := uvaS3ObjectImpl{storageClass: STORAGE_CLASS_GLACIER, isGlacier: true}
+	archiveAccess := uvaS3ObjectImpl{storageClass: STORAGE_CLASS_INTELLIGENT_TIERING, archiveStatus: "ARCHIVE_ACCESS", isGlacier: true}
+
+	if validRestoreTier(deepArchive, RESTORE_EXPEDITED) != false {
+		t.Fatalf("Unexpected valid value. Expected %t, got %t\n", false, true)
+	}
+	if validRestoreTier(deepArchive, RESTORE_STANDARD) != true {
+		t.Fatalf("Unexpected valid value. Expected %t, got %t\n", true, false)
+	}
+	if validRestoreTier(glacier, RESTORE_EXPEDITED) != true {
+		t.Fatalf("Unexpected valid value. Expected %t, got %t\n", true, false)
+	}
+	if validRestoreTier(archiveAccess, RESTORE_EXPEDITED) != false {
+		t.Fatalf("Unexpected valid value. Expected %t, got %t\n", false, true)
+	}
+	if validRestoreTier(archiveAccess, RESTORE_BULK) != true {
+		t.Fatalf("Unexpected valid value. Expected %t, got %t\n", true, false)
+	}
+}
+
+func TestRestoreTargetDeepArchive(t *testing.T) {
+
+	// a deep archive object that has not been restored
+	restores := 0
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		switch r.Operation.Name {
+		case "HeadObject":
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, ""), ""
+		case "RestoreObject":
+			restores++
+			return http.StatusAccepted, nil, ""
+		}
+		return http.StatusBadRequest, nil, stubErrorBody("Unexpected")
+	})
+
+	o := goodGlacierS3Object()
+	s, err := uvas3.restoreTarget(context.Background(), o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if s.IsGlacier() != true || s.StorageClass() != STORAGE_CLASS_DEEP_ARCHIVE {
+		t.Fatalf("Unexpected attributes. Expected %t/%s, got %t/%s\n", true, STORAGE_CLASS_DEEP_ARCHIVE, s.IsGlacier(), s.StorageClass())
+	}
+
+	// expedited restores are not available for deep archive
+	err = uvas3.RestoreObject(o, RESTORE_EXPEDITED, 1)
+	expected := ErrTierNotSupported
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+
+	// but standard restores are
+	err = uvas3.RestoreObject(o, RESTORE_STANDARD, 1)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if restores != 1 {
+		t.Fatalf("Unexpected restore requests. Expected 1, got %d\n", restores)
+	}
+}
+
+//
+// UpgradeRestore method invariant tests
+//
+
+func TestUpgradeRestoreNotGlacier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	err := uvas3.UpgradeRestore(goodS3Object(), RESTORE_STANDARD, 1)
+	expected := ErrCannotRestore
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestUpgradeRestoreNotRestoring(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.UpgradeRestore(goodGlacierS3Object(), RESTORE_STANDARD, 1)
+	expected := ErrNotRestoring
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestUpgradeRestoreBadTier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.UpgradeRestore(goodGlacierS3Object(), RESTORE_BULK, 1)
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// ExtendRestore method invariant tests
+//
+
+func TestExtendRestoreNotGlacier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	err := uvas3.ExtendRestore(goodS3Object(), 1)
+	expected := ErrCannotRestore
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestExtendRestoreNotRestored(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ExtendRestore(goodGlacierS3Object(), 1)
+	expected := ErrNotRestored
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestExtendRestoreBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ExtendRestore(badKeyS3Object(), 1)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// WaitForRestore method invariant tests
+//
+
+func TestWaitForRestoreNotGlacier(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	// objects that are not archived are available immediately
+	s, err := uvas3.WaitForRestore(context.Background(), goodS3Object(), UvaS3PollPolicy{})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if s.KeyName() != goodObjectName {
+		t.Fatalf("Unexpected key name. Expected %s, got %s\n", goodObjectName, s.KeyName())
+	}
+}
+
+func TestWaitForRestoreNotRestoring(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.WaitForRestore(context.Background(), goodGlacierS3Object(), UvaS3PollPolicy{})
+	expected := ErrNotRestoring
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestWaitForRestoreBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.WaitForRestore(context.Background(), badKeyS3Object(), UvaS3PollPolicy{})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestWaitForRestoreTimeoutDuringCheck(t *testing.T) {
+
+	// the deadline passes while we are checking the restore status
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		<-r.Context().Done()
+		return 0, nil, ""
+	})
+
+	_, err := uvas3.WaitForRestore(context.Background(), goodGlacierS3Object(), UvaS3PollPolicy{Timeout: 10 * time.Millisecond})
+	expected := ErrRestoreTimeout
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestNextPollInterval(t *testing.T) {
+
+	policy := pollPolicyDefaults(UvaS3PollPolicy{InitialInterval: time.Minute, MaxInterval: 5 * time.Minute})
+	expected := []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	interval := policy.InitialInterval
+	for _, e := range expected {
+		interval = nextPollInterval(policy, interval)
+		if interval != e {
+			t.Fatalf("Unexpected interval. Expected %s, got %s\n", e, interval)
+		}
+	}
+}
+
+//
+// restore manager invariant tests
+//
+
+func TestRestoreManagerResume(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	journal := t.TempDir() + "/restore.journal"
+	config := UvaS3RestoreConfig{Journal: journal, Tier: RESTORE_BULK, Days: 1, Logging: logging}
+	manager, err := NewUvaS3RestoreManager(uvas3, config)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// objects that are not archived are immediately available
+	err = manager.RequestObjects(context.Background(), []UvaS3Object{goodS3Object()})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = manager.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	expected := UvaS3RestoreProgress{Total: 1, Restored: 1}
+	if manager.Progress() != expected {
+		t.Fatalf("Unexpected progress. Expected %+v, got %+v\n", expected, manager.Progress())
+	}
+
+	// a new manager using the same journal resumes with the same state
+	manager, err = NewUvaS3RestoreManager(uvas3, config)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if manager.Progress() != expected {
+		t.Fatalf("Unexpected progress. Expected %+v, got %+v\n", expected, manager.Progress())
+	}
+}
+
+func TestRestoreManagerBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	config := UvaS3RestoreConfig{Journal: t.TempDir() + "/restore.journal", Tier: RESTORE_BULK, Days: 1, Logging: logging}
+	manager, err := NewUvaS3RestoreManager(uvas3, config)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = manager.RequestObjects(context.Background(), []UvaS3Object{badKeyS3Object()})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	expected := UvaS3RestoreProgress{Total: 1, Failed: 1}
+	if manager.Progress() != expected {
+		t.Fatalf("Unexpected progress. Expected %+v, got %+v\n", expected, manager.Progress())
+	}
+}
+
+func TestRestoreManagerDeepArchive(t *testing.T) {
+
+	// a prefix of deep archive objects, S3 refuses to restore one of them
+	listing := `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>` +
+		`<Contents><Key>prefix/good</Key><Size>10</Size><StorageClass>DEEP_ARCHIVE</StorageClass></Contents>` +
+		`<Contents><Key>prefix/bad</Key><Size>10</Size><StorageClass>DEEP_ARCHIVE</StorageClass></Contents>` +
+		`</ListBucketResult>`
+	uvas3 := stubS3(t, UvaS3Config{Logging: logging}, func(r *request.Request) (int, http.Header, string) {
+		switch r.Operation.Name {
+		case "ListObjectsV2":
+			return http.StatusOK, nil, listing
+		case "HeadObject":
+			return http.StatusOK, stubHeadHeader(STORAGE_CLASS_DEEP_ARCHIVE, ""), ""
+		case "RestoreObject":
+			if aws.StringValue(r.Params.(*s3.RestoreObjectInput).Key) == "prefix/bad" {
+				return http.StatusForbidden, nil, stubErrorBody(s3.ErrCodeInvalidObjectState)
+			}
+			return http.StatusAccepted, nil, ""
+		}
+		return http.StatusBadRequest, nil, stubErrorBody("Unexpected")
+	})
+
+	journal := t.TempDir() + "/restore.journal"
+	manager, err := NewUvaS3RestoreManager(uvas3, UvaS3RestoreConfig{Journal: journal, Tier: RESTORE_BULK, Days: 1, Logging: logging})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = manager.RequestPrefix(context.Background(), "bucket", "prefix/")
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// nothing is restored yet
+	expected := UvaS3RestoreProgress{Total: 2, Requested: 1, Failed: 1}
+	if manager.Progress() != expected {
+		t.Fatalf("Unexpected progress. Expected %+v, got %+v\n", expected, manager.Progress())
+	}
+}
+
+func TestRestoreManagerBadConfig(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := NewUvaS3RestoreManager(uvas3, UvaS3RestoreConfig{Tier: RESTORE_UNDEFINED, Days: 1})
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// DeleteObject method invariant tests
+//
+
+func TestDeleteObjectHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available and delete the local sink file
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	// delete the object
+	o := goodS3Object()
+	err := uvas3.DeleteObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify object does not exist
+	if objectExists(t, uvas3, o) != false {
+		t.Fatalf("Object was not deleted successfully\n")
+	}
+}
+
+func TestDeleteObjectBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// get the object
+	o := badBucketS3Object()
+	err := uvas3.DeleteObject(o)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
 	}
 }
 
 func TestDeleteObjectBadKeyName(t *testing.T) {
 	uvas3 := testSetup(t)
 
-	// get the object
-	o := badKeyS3Object()
+	// get the object
+	o := badKeyS3Object()
+	err := uvas3.DeleteObject(o)
+	//expected := ErrNotFound
+	var expected error = nil // the AWS S3 API will return success when deleting a non-existent object
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// CopyObject method invariant tests
+//
+
+func TestCopyObjectHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available and the destination does not exist
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	dst := NewUvaS3Object(goodBucketName, copyObjectName)
+	err := uvas3.DeleteObject(dst)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = uvas3.CopyObject(goodS3Object(), dst, UvaS3CopyOptions{})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// get copied object details
+	s, err := uvas3.StatObject(dst)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify size
+	sz := fileSize(goodSourceFile)
+	if sz != s.Size() {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", sz, s.Size())
+	}
+}
+
+func TestCopyObjectGlacierObject(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.CopyObject(goodGlacierS3Object(), NewUvaS3Object(goodBucketName, copyObjectName), UvaS3CopyOptions{})
+	expected := ErrObjectInGlacier
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestCopyObjectBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.CopyObject(badBucketS3Object(), NewUvaS3Object(goodBucketName, copyObjectName), UvaS3CopyOptions{})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestCopyObjectBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.CopyObject(badKeyS3Object(), NewUvaS3Object(goodBucketName, copyObjectName), UvaS3CopyOptions{})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// MoveObject method invariant tests
+//
+
+func TestMoveObjectHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+	src := goodS3Object()
+	dst := NewUvaS3Object(goodBucketName, copyObjectName)
+
+	err := uvas3.MoveObject(src, dst)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify the source is gone and the destination exists
+	if objectExists(t, uvas3, src) != false {
+		t.Fatalf("Source object was not deleted successfully\n")
+	}
+	if objectExists(t, uvas3, dst) != true {
+		t.Fatalf("Destination object does not exist\n")
+	}
+}
+
+func TestMoveObjectSameObject(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.MoveObject(goodS3Object(), goodS3Object())
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestMoveObjectBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.MoveObject(badKeyS3Object(), NewUvaS3Object(goodBucketName, copyObjectName))
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// ChangeStorageClass method invariant tests
+//
+
+func TestChangeStorageClassHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	err := uvas3.ChangeStorageClass(goodS3Object(), STORAGE_CLASS_STANDARD_IA)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// and back again
+	err = uvas3.ChangeStorageClass(goodS3Object(), STORAGE_CLASS_STANDARD)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+}
+
+func TestChangeStorageClassGlacierObject(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ChangeStorageClass(goodGlacierS3Object(), STORAGE_CLASS_STANDARD)
+	expected := ErrObjectInGlacier
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestChangeStorageClassBadStorageClass(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ChangeStorageClass(goodS3Object(), UvaS3StorageClass("BAD"))
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestChangeStorageClassBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ChangeStorageClass(badKeyS3Object(), STORAGE_CLASS_STANDARD_IA)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestChangeStorageClassOldVersion(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// upload the object twice so we have at least 2 versions
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+
+	versions := listTestVersions(t, uvas3, versionedBucketName, goodObjectName)
+	if len(versions) < 2 {
+		t.Fatalf("Unexpected version count. Expected at least 2, got %d\n", len(versions))
+	}
+
+	// changing a previous version would make it current again
+	o := NewUvaS3ObjectVersion(versionedBucketName, goodObjectName, versions[1].VersionId())
+	err := uvas3.ChangeStorageClass(o, STORAGE_CLASS_STANDARD_IA)
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestParseHeaderAttributes(t *testing.T) {
+
+	attribs := parseHeaderAttributes("expiry-date=\"Fri, 23 Dec 2012 00:00:00 GMT\", rule-id=\"picture-deletion-rule\"")
+	if attribs["expiry-date"] != "Fri, 23 Dec 2012 00:00:00 GMT" {
+		t.Fatalf("Unexpected expiry-date. Expected %s, got %s\n", "Fri, 23 Dec 2012 00:00:00 GMT", attribs["expiry-date"])
+	}
+	if attribs["rule-id"] != "picture-deletion-rule" {
+		t.Fatalf("Unexpected rule-id. Expected %s, got %s\n", "picture-deletion-rule", attribs["rule-id"])
+	}
+
+	attribs = parseHeaderAttributes("ongoing-request=\"true\"")
+	if len(attribs) != 1 || attribs["ongoing-request"] != "true" {
+		t.Fatalf("Unexpected ongoing-request. Expected %s, got %s\n", "true", attribs["ongoing-request"])
+	}
+}
+
+func TestCopySource(t *testing.T) {
+
+	expected := "bucket/a%20dir/a%2Bfile.tif"
+	actual := copySource(NewUvaS3Object("bucket", "a dir/a+file.tif"))
+	if actual != expected {
+		t.Fatalf("Unexpected copy source. Expected %s, got %s\n", expected, actual)
+	}
+
+	expected = "bucket/key?versionId=abc%2B123"
+	actual = copySource(NewUvaS3ObjectVersion("bucket", "key", "abc+123"))
+	if actual != expected {
+		t.Fatalf("Unexpected copy source. Expected %s, got %s\n", expected, actual)
+	}
+}
+
+//
+// DeleteObjects method invariant tests
+//
+
+func TestDeleteObjectsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have some test objects available
+	objs := make([]UvaS3Object, 0)
+	for ix := 0; ix < 3; ix++ {
+		key := fmt.Sprintf("%s-%d", goodObjectName, ix)
+		uploadTestObject(t, uvas3, goodBucketName, key)
+		objs = append(objs, NewUvaS3Object(goodBucketName, key))
+	}
+
+	results, err := uvas3.DeleteObjects(objs)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	if len(results) != len(objs) {
+		t.Fatalf("Unexpected result count. Expected %d, got %d\n", len(objs), len(results))
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s\n", r.Err.Error())
+		}
+		// verify object does not exist
+		if objectExists(t, uvas3, r.Object) != false {
+			t.Fatalf("Object was not deleted successfully\n")
+		}
+	}
+}
+
+func TestDeleteObjectsBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	results, err := uvas3.DeleteObjects([]UvaS3Object{badBucketS3Object()})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	expected := ErrNotFound
+	if results[0].Err != expected {
+		errorEvaluate(t, expected, results[0].Err)
+	}
+}
+
+func TestDeleteObjectsBadParameter(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.DeleteObjects([]UvaS3Object{goodS3Object(), NewUvaS3Object(goodBucketName, "")})
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// ListObjects method invariant tests
+//
+
+func TestListObjectsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	found := false
+	_, err := uvas3.ListObjects(goodBucketName, goodObjectName, "", func(o UvaS3Object) bool {
+		if o.KeyName() == goodObjectName {
+			found = true
+			if o.Size() != fileSize(goodSourceFile) {
+				t.Fatalf("Unexpected size. Expected %d, got %d\n", fileSize(goodSourceFile), o.Size())
+			}
+			if o.LastModified().IsZero() {
+				t.Fatalf("Unexpected last modified value. Expected non-zero, got %x\n", o.LastModified())
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	if found == false {
+		t.Fatalf("Expected object was not listed\n")
+	}
+}
+
+func TestListObjectsDelimiter(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// the glacier key is below a "directory" so we should get it back as a common prefix
+	prefixes, err := uvas3.ListObjects(glacierBucketName, "", "/", func(o UvaS3Object) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	expected := glacierKeyName[:strings.Index(glacierKeyName, "/")+1]
+	for _, p := range prefixes {
+		if p == expected {
+			return
+		}
+	}
+	t.Fatalf("Expected common prefix %s was not listed\n", expected)
+}
+
+func TestListObjectsBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.ListObjects(badBucketName, "", "", func(o UvaS3Object) bool {
+		return true
+	})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestIsGlacierStorageClass(t *testing.T) {
+
+	tests := map[UvaS3StorageClass]bool{
+		STORAGE_CLASS_STANDARD:            false,
+		STORAGE_CLASS_REDUCED_REDUNDANCY:  false,
+		STORAGE_CLASS_STANDARD_IA:         false,
+		STORAGE_CLASS_ONEZONE_IA:          false,
+		STORAGE_CLASS_INTELLIGENT_TIERING: false,
+		STORAGE_CLASS_GLACIER_IR:          false,
+		STORAGE_CLASS_GLACIER:             true,
+		STORAGE_CLASS_DEEP_ARCHIVE:        true,
+	}
+
+	for class, expected := range tests {
+		actual := isGlacierStorageClass(aws.String(string(class)))
+		if actual != expected {
+			t.Fatalf("Unexpected result for %s. Expected %t, got %t\n", class, expected, actual)
+		}
+	}
+
+	// S3 omits the storage class of STANDARD objects
+	if isGlacierStorageClass(nil) != false {
+		t.Fatalf("Unexpected result for no storage class. Expected false, got true\n")
+	}
+}
+
+//
+// bucket method invariant tests
+//
+
+func TestCreateDeleteBucketHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// create a new bucket
+	bucket := fmt.Sprintf("%s-%d", goodBucketName, time.Now().Unix())
+	err := uvas3.CreateBucket(bucket, "")
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// add an object so the delete must empty the bucket
+	uploadTestObject(t, uvas3, bucket, goodObjectName)
+
+	err = uvas3.DeleteBucket(bucket, true)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// verify bucket does not exist
+	exists, err := uvas3.BucketExists(bucket)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if exists != false {
+		t.Fatalf("Bucket was not deleted successfully\n")
+	}
+}
+
+func TestCreateBucketExists(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.CreateBucket(goodBucketName, "")
+	expected := ErrBucketExists
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestDeleteBucketNotEmpty(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, goodBucketName, goodObjectName)
+
+	err := uvas3.DeleteBucket(goodBucketName, false)
+	expected := ErrBucketNotEmpty
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestDeleteBucketBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.DeleteBucket(badBucketName, false)
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestCreateBucketNoRegion(t *testing.T) {
+
+	// a session that has no region
+	sess, err := session.NewSession(aws.NewConfig().WithRegion(""))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	uvas3 := &uvaS3Impl{sess: sess}
+
+	err = uvas3.CreateBucket(goodBucketName, "")
+	expected := ErrBadParameter
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestBucketExistsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	exists, err := uvas3.BucketExists(goodBucketName)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if exists != true {
+		t.Fatalf("Unexpected exists value. Expected %t, got %t\n", true, exists)
+	}
+}
+
+func TestBucketExistsBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	exists, err := uvas3.BucketExists(badBucketName)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if exists != false {
+		t.Fatalf("Unexpected exists value. Expected %t, got %t\n", false, exists)
+	}
+}
+
+func TestListBucketsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	buckets, err := uvas3.ListBuckets()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	for _, b := range buckets {
+		if b == goodBucketName {
+			return
+		}
+	}
+	t.Fatalf("Expected bucket %s was not listed\n", goodBucketName)
+}
+
+//
+// object version method invariant tests
+//
+
+func TestObjectVersionsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// upload the object twice so we have at least 2 versions
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+
+	versions := listTestVersions(t, uvas3, versionedBucketName, goodObjectName)
+	if len(versions) < 2 {
+		t.Fatalf("Unexpected version count. Expected at least 2, got %d\n", len(versions))
+	}
+
+	// the most recent upload is the latest version and the previous one is not
+	if versions[0].IsLatest() != true || versions[1].IsLatest() != false {
+		t.Fatalf("Unexpected latest values. Expected %t/%t, got %t/%t\n", true, false, versions[0].IsLatest(), versions[1].IsLatest())
+	}
+
+	// stat and get the previous version
+	o := NewUvaS3ObjectVersion(versionedBucketName, goodObjectName, versions[1].VersionId())
+	s, err := uvas3.StatObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if s.VersionId() != versions[1].VersionId() {
+		t.Fatalf("Unexpected version id. Expected %s, got %s\n", versions[1].VersionId(), s.VersionId())
+	}
+
+	b, err := uvas3.GetToBuffer(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if int64(len(b)) != s.Size() {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", s.Size(), len(b))
+	}
+
+	// delete the previous version and verify it is gone
+	err = uvas3.DeleteObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if objectExists(t, uvas3, o) != false {
+		t.Fatalf("Object version was not deleted successfully\n")
+	}
+}
+
+func TestObjectVersionsDeleteMarker(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available then delete it leaving a delete marker
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+	err := uvas3.DeleteObject(NewUvaS3Object(versionedBucketName, goodObjectName))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	versions := listTestVersions(t, uvas3, versionedBucketName, goodObjectName)
+	if len(versions) == 0 || versions[0].IsDeleteMarker() != true {
+		t.Fatalf("Expected delete marker was not listed\n")
+	}
+}
+
+func TestListObjectVersionsBadBucketName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	err := uvas3.ListObjectVersions(badBucketName, "", func(o UvaS3Object) bool {
+		return true
+	})
+	expected := ErrNotFound
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+//
+// UndeleteObject(s) method invariant tests
+//
+
+func TestUndeleteObjectHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available then delete it
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+	o := NewUvaS3Object(versionedBucketName, goodObjectName)
 	err := uvas3.DeleteObject(o)
-	//expected := ErrNotFound
-	var expected error = nil // the AWS S3 API will return success when deleting a non-existent object
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	s, err := uvas3.UndeleteObject(o)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	if s.Size() != fileSize(goodSourceFile) {
+		t.Fatalf("Unexpected size. Expected %d, got %d\n", fileSize(goodSourceFile), s.Size())
+	}
+
+	// verify object exists
+	if objectExists(t, uvas3, o) != true {
+		t.Fatalf("Object was not undeleted successfully\n")
+	}
+}
+
+func TestUndeleteObjectNotDeleted(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+
+	_, err := uvas3.UndeleteObject(NewUvaS3Object(versionedBucketName, goodObjectName))
+	expected := ErrNotDeleted
+	if err != expected {
+		errorEvaluate(t, expected, err)
+	}
+}
+
+func TestUndeleteObjectBadKeyName(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	_, err := uvas3.UndeleteObject(NewUvaS3Object(versionedBucketName, badObjectName))
+	expected := ErrNotFound
 	if err != expected {
 		errorEvaluate(t, expected, err)
 	}
 }
 
+func TestUndeleteObjectsHappyDay(t *testing.T) {
+	uvas3 := testSetup(t)
+
+	// ensure we have a test object available then delete it
+	uploadTestObject(t, uvas3, versionedBucketName, goodObjectName)
+	since := time.Now().Add(-1 * time.Minute)
+	err := uvas3.DeleteObject(NewUvaS3Object(versionedBucketName, goodObjectName))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	recovered, err := uvas3.UndeleteObjects(versionedBucketName, goodObjectName, since)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	for _, o := range recovered {
+		if o.KeyName() == goodObjectName {
+			return
+		}
+	}
+	t.Fatalf("Expected object was not recovered\n")
+}
+
+func TestUndeleteMarkers(t *testing.T) {
+
+	now := time.Now()
+	version := uvaS3ObjectImpl{key: goodObjectName, versionId: "v1", lastModified: now.Add(-3 * time.Hour)}
+	marker1 := uvaS3ObjectImpl{key: goodObjectName, versionId: "m1", isDelete: true, lastModified: now.Add(-2 * time.Hour)}
+	marker2 := uvaS3ObjectImpl{key: goodObjectName, versionId: "m2", isDelete: true, isLatest: true, lastModified: now.Add(-1 * time.Hour)}
+
+	// both markers hide the version, the object was deleted when the oldest was created
+	markers, deleted, found := undeleteMarkers([]UvaS3Object{marker2, marker1, version})
+	if found != true || len(markers) != 2 || deleted != marker1.lastModified {
+		t.Fatalf("Unexpected result. Expected %t/%d/%s, got %t/%d/%s\n", true, 2, marker1.lastModified, found, len(markers), deleted)
+	}
+
+	// the current version is not deleted
+	_, _, found = undeleteMarkers([]UvaS3Object{version, marker1})
+	if found != false {
+		t.Fatalf("Unexpected found value. Expected %t, got %t\n", false, found)
+	}
+
+	// nothing to recover
+	_, _, found = undeleteMarkers([]UvaS3Object{marker2, marker1})
+	if found != false {
+		t.Fatalf("Unexpected found value. Expected %t, got %t\n", false, found)
+	}
+}
+
 //
 // helper methods
 //
@@ -489,6 +2587,38 @@ func uploadTestObject(t *testing.T, uvas3 UvaS3, bucket string, key string) {
 	}
 }
 
+func listTestVersions(t *testing.T, uvas3 UvaS3, bucket string, key string) []UvaS3Object {
+
+	versions := make([]UvaS3Object, 0)
+	err := uvas3.ListObjectVersions(bucket, key, func(o UvaS3Object) bool {
+		if o.KeyName() == key {
+			versions = append(versions, o)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	return versions
+}
+
+func verifyTestTags(t *testing.T, uvas3 UvaS3, object UvaS3Object, expected map[string]string) {
+
+	tags, err := uvas3.GetObjectTags(object)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	if len(tags) != len(expected) {
+		t.Fatalf("Unexpected tag count. Expected %d, got %d\n", len(expected), len(tags))
+	}
+	for k, v := range expected {
+		if tags[k] != v {
+			t.Fatalf("Unexpected tag value for %s. Expected %s, got %s\n", k, v, tags[k])
+		}
+	}
+}
+
 func objectExists(t *testing.T, uvas3 UvaS3, object UvaS3Object) bool {
 	_, err := uvas3.StatObject(object)
 	switch err {
@@ -539,6 +2669,61 @@ func badKeyS3Object() UvaS3Object {
 	return NewUvaS3Object(goodBucketName, badObjectName)
 }
 
+// an S3 implementation whose requests are answered by the supplied function rather than S3. The function
+// returns the response status, headers and body for the request, a zero status abandons the request
+func stubS3(t *testing.T, config UvaS3Config, respond func(*request.Request) (int, http.Header, string)) *uvaS3Impl {
+
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1").WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	svc := s3.New(sess)
+	svc.Handlers.Send.Clear()
+	svc.Handlers.Send.PushBack(func(r *request.Request) {
+		status, header, body := respond(r)
+		if status == 0 {
+			// the request was abandoned, as the SDK reports it
+			r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", r.Context().Err())
+			return
+		}
+		if header == nil {
+			header = http.Header{}
+		}
+		r.HTTPResponse = &http.Response{StatusCode: status, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+	})
+
+	var impl uvaS3Impl
+	impl.config = config
+	impl.sess = sess
+	impl.svc = svc
+	impl.uploader = s3manager.NewUploaderWithClient(svc)
+	impl.downloader = s3manager.NewDownloaderWithClient(svc)
+	return &impl
+}
+
+// the content of our stub objects
+var stubContent = "0123456789"
+
+// the headers S3 returns for an object in the supplied storage class
+func stubHeadHeader(storageClass UvaS3StorageClass, restore string) http.Header {
+	header := http.Header{}
+	header.Set("Content-Length", "10")
+	header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	header.Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum([]byte(stubContent))))
+	header.Set("X-Amz-Storage-Class", string(storageClass))
+	if len(restore) != 0 {
+		header.Set("X-Amz-Restore", restore)
+	}
+	return header
+}
+
+// the body S3 returns for an error
+func stubErrorBody(code string) string {
+	return fmt.Sprintf("<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	if err == nil {